@@ -0,0 +1,73 @@
+package consistenthashing
+
+import (
+	"fmt"
+	"math"
+)
+
+// WithBoundedLoad 开启consistent hashing with bounded loads模式。
+// 每个节点的负载上限为 ceil((1+epsilon) * (总负载+1) * 节点容量 / 总容量)，
+// 查找时顺时针跳过负载已达上限的节点，避免节点较少时某个节点承担过多的任务
+func WithBoundedLoad(epsilon float64) Option {
+	return func(chr *ConsistentHashingRing) {
+		if epsilon > 0 {
+			chr.bounded = true
+			chr.epsilon = epsilon
+		}
+	}
+}
+
+// loadLimits 计算每个节点当前的负载上限，调用者需持有锁
+func (chr *ConsistentHashingRing) loadLimits() map[string]int64 {
+	totalCap := int64(0)
+	for _, node := range chr.Nodes {
+		totalCap += node.Cap
+	}
+
+	limits := make(map[string]int64, len(chr.Nodes))
+	avg := (1 + chr.epsilon) * float64(chr.totalLoad+1)
+	for name, node := range chr.Nodes {
+		if totalCap == 0 {
+			//容量都为0时按节点平均
+			limits[name] = int64(math.Ceil(avg / float64(len(chr.Nodes))))
+			continue
+		}
+		limits[name] = int64(math.Ceil(avg * float64(node.Cap) / float64(totalCap)))
+	}
+	return limits
+}
+
+// Acquire 为key选择节点并把该节点的负载加1，任务结束后需要调用Release
+func (chr *ConsistentHashingRing) Acquire(key string) (Node, error) {
+	chr.rwLock.Lock()
+	defer chr.rwLock.Unlock()
+
+	node, err := chr.locate(key)
+	if err != nil {
+		return Node{}, err
+	}
+	node.Load++
+	chr.Nodes[node.Name] = node
+	chr.totalLoad++
+
+	return node, nil
+}
+
+// Release 把节点的负载减1
+func (chr *ConsistentHashingRing) Release(name string) error {
+	chr.rwLock.Lock()
+	defer chr.rwLock.Unlock()
+
+	node, ok := chr.Nodes[name]
+	if !ok {
+		return fmt.Errorf("%s: %w", name, ErrNodeNotFound)
+	}
+	if node.Load <= 0 {
+		return fmt.Errorf("%s has no load to release", name)
+	}
+	node.Load--
+	chr.Nodes[name] = node
+	chr.totalLoad--
+
+	return nil
+}
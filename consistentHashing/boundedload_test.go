@@ -0,0 +1,99 @@
+package consistenthashing_test
+
+import (
+	"fmt"
+	consistenthashing "test/consistentHashing"
+	"testing"
+)
+
+func TestBoundedLoad(t *testing.T) {
+	const epsilon = 0.25
+	ring := consistenthashing.NewConsistentHashingRing(consistenthashing.WithBoundedLoad(epsilon))
+	for _, name := range []string{"cluster-a", "cluster-b", "cluster-c"} {
+		if err := ring.AddNode(name, 100*GiB); err != nil {
+			t.Fatalf("add node failed with %v", err)
+		}
+	}
+
+	//所有任务用同一个key，普通模式下全部落在同一个节点
+	total := 300
+	for i := 0; i < total; i++ {
+		if _, err := ring.Acquire("hot-dataset"); err != nil {
+			t.Fatalf("acquire failed with %v", err)
+		}
+	}
+	limit := int64(float64(total)/3*(1+epsilon)) + 1
+	sum := int64(0)
+	for name, node := range ring.Nodes {
+		if node.Load > limit {
+			t.Fatalf("%s load %d over limit %d", name, node.Load, limit)
+		}
+		sum += node.Load
+		t.Logf("%s load %d", name, node.Load)
+	}
+	if sum != int64(total) {
+		t.Fatalf("total load want %d but get %d", total, sum)
+	}
+
+	//负载满的节点被跳过
+	first, _ := ring.Locate("hot-dataset")
+	nodes, err := ring.LocateN("hot-dataset", 3)
+	if err != nil || len(nodes) != 3 || nodes[0].Name != first.Name {
+		t.Fatalf("locate n get %v, %v", nodes, err)
+	}
+
+	for name, node := range ring.Nodes {
+		for i := int64(0); i < node.Load; i++ {
+			if err := ring.Release(name); err != nil {
+				t.Fatalf("release failed with %v", err)
+			}
+		}
+	}
+	if err := ring.Release("cluster-a"); err == nil {
+		t.Fatalf("release without load want err but not")
+	}
+}
+
+func TestBoundedLoadWeighted(t *testing.T) {
+	ring := consistenthashing.NewConsistentHashingRing(consistenthashing.WithBoundedLoad(0.1))
+	if err := ring.AddNode("small", 100*GiB); err != nil {
+		t.Fatalf("add node failed with %v", err)
+	}
+	if err := ring.AddNode("big", 300*GiB); err != nil {
+		t.Fatalf("add node failed with %v", err)
+	}
+	for i := 0; i < 400; i++ {
+		if _, err := ring.Acquire(fmt.Sprintf("key-%d", i%3)); err != nil {
+			t.Fatalf("acquire failed with %v", err)
+		}
+	}
+	if small := ring.Nodes["small"].Load; small > 111 {
+		t.Fatalf("small node load %d over its share", small)
+	}
+	if big := ring.Nodes["big"].Load; big > 331 {
+		t.Fatalf("big node load %d over its share", big)
+	}
+
+	//删除节点后负载一起去掉
+	if err := ring.RemoveNode("big"); err != nil {
+		t.Fatalf("remove node failed with %v", err)
+	}
+	node, err := ring.Acquire("key-0")
+	if err != nil || node.Name != "small" {
+		t.Fatalf("acquire get %v, %v", node.Name, err)
+	}
+}
+
+func TestUnboundedLocateIgnoresLoad(t *testing.T) {
+	ring := newRing(t, "cluster-a", "cluster-b")
+	first, _ := ring.Locate("hot-dataset")
+	for i := 0; i < 100; i++ {
+		node, err := ring.Acquire("hot-dataset")
+		if err != nil || node.Name != first.Name {
+			t.Fatalf("acquire get %v, %v", node.Name, err)
+		}
+	}
+	if ring.Nodes[first.Name].Load != 100 {
+		t.Fatalf("load not tracked")
+	}
+}
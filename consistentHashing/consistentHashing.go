@@ -1,53 +1,302 @@
 package consistenthashing
 
 import (
-	"crypto/sha256"
+	"errors"
 	"fmt"
+	"sort"
 	"sync"
 )
 
 const (
-	defaultVnodeCap = 10 //G
+	defaultVnodeCap  = 10 //G
+	defaultMinVnodes = 1
+)
+
+var (
+	ErrEmptyRing      = errors.New("consistent hashing ring is empty")
+	ErrNodeNotFound   = errors.New("node not found")
+	ErrNotEnoughNodes = errors.New("not enough nodes")
 )
 
 type ConsistentHashingRing struct {
-	rwLock sync.RWMutex
-	Nodes  map[string]Node //key is node name
-	Vnodes []Vnode
+	rwLock    sync.RWMutex
+	hasher    Hasher
+	vnodeCap  int64   //每个虚拟节点代表的容量，单位字节
+	minVnodes int     //每个物理节点最少的虚拟节点数
+	bounded   bool    //是否开启bounded load模式
+	epsilon   float64 //bounded load模式下允许超过平均负载的比例
+	totalLoad int64   //所有节点的负载之和
+	version   uint64  //每次成员变化加1
+	subs      map[<-chan RingEvent]chan RingEvent
+	Nodes     map[string]Node //key is node name
+	Vnodes    []Vnode         //按hash升序排列
 }
 
 type Node struct {
 	Name   string
 	Cap    int64
-	Vnodes map[int64]Vnode //key is vnode hash
+	Load   int64            //已分配的负载，通过Acquire和Release维护
+	Vnodes map[uint64]Vnode //key is vnode hash
 }
 
 type Vnode struct {
+	Hash uint64
+	Node string //所属的物理节点
+	Idx  int    //在物理节点内的编号
+}
+
+type Option func(*ConsistentHashingRing)
+
+// WithVnodeCap 设置每个虚拟节点代表的容量（字节），默认10G
+func WithVnodeCap(vnodeCap int64) Option {
+	return func(chr *ConsistentHashingRing) {
+		if vnodeCap > 0 {
+			chr.vnodeCap = vnodeCap
+		}
+	}
 }
 
-func NewConsistentHashingRing() *ConsistentHashingRing {
-	return &ConsistentHashingRing{Nodes: make(map[string]Node)}
+// WithMinVnodes 设置每个物理节点最少的虚拟节点数，容量很小的节点也能分到数据，默认1
+func WithMinVnodes(n int) Option {
+	return func(chr *ConsistentHashingRing) {
+		if n > 0 {
+			chr.minVnodes = n
+		}
+	}
+}
+
+// WithHasher 设置计算hash的算法，默认SHA256Hasher。同一份数据的所有环必须使用相同的算法
+func WithHasher(hasher Hasher) Option {
+	return func(chr *ConsistentHashingRing) {
+		if hasher != nil {
+			chr.hasher = hasher
+		}
+	}
+}
+
+func NewConsistentHashingRing(opts ...Option) *ConsistentHashingRing {
+	chr := &ConsistentHashingRing{
+		hasher:    SHA256Hasher,
+		vnodeCap:  defaultVnodeCap * 1024 * 1024 * 1024,
+		minVnodes: defaultMinVnodes,
+		Nodes:     make(map[string]Node),
+	}
+	for _, opt := range opts {
+		opt(chr)
+	}
+	return chr
+}
+
+func (chr *ConsistentHashingRing) vnodeHash(name string, idx int) uint64 {
+	vnodeName := fmt.Sprintf("%s-%05d", name, idx)
+	return chr.hasher.Sum64([]byte(vnodeName))
+}
+
+func (chr *ConsistentHashingRing) keyHash(key string) uint64 {
+	return chr.hasher.Sum64([]byte(key))
+}
+
+// nrVnodes 根据容量计算虚拟节点数
+func (chr *ConsistentHashingRing) nrVnodes(cap int64) int {
+	nr := int(cap / chr.vnodeCap)
+	if nr < chr.minVnodes {
+		nr = chr.minVnodes
+	}
+	return nr
 }
 
 func (chr *ConsistentHashingRing) AddNode(name string, cap int64) error {
+	chr.rwLock.Lock()
+	defer chr.rwLock.Unlock()
+
 	//检查节点是否已经存在
 	if _, ok := chr.Nodes[name]; ok {
 		return fmt.Errorf("%s already exist", name)
 	}
+	if cap < 0 {
+		return fmt.Errorf("bad capacity %d", cap)
+	}
 
-	// node := Node{
-	// 	Name:   name,
-	// 	Cap:    cap,
-	// 	Vnodes: make(map[int64]Vnode),
-	// }
+	node := Node{
+		Name:   name,
+		Cap:    cap,
+		Vnodes: make(map[uint64]Vnode),
+	}
 
 	//生成hash，并添加到hash环
-	nrVnodes := int(cap / (defaultVnodeCap * 1024 * 1024 * 1024))
-	for i := 0; i < nrVnodes; i++ {
-		vnodeName := fmt.Sprintf("%s-%05d", name, i)
-		hash := sha256.New()
-		hash.Write([]byte(vnodeName))
+	chr.growVnodes(node, chr.nrVnodes(cap))
+	chr.Nodes[name] = node
+	chr.publish(RingEvent{Type: NodeAdded, Node: name, Cap: cap})
+
+	return nil
+}
+
+func (chr *ConsistentHashingRing) RemoveNode(name string) error {
+	chr.rwLock.Lock()
+	defer chr.rwLock.Unlock()
+
+	if _, ok := chr.Nodes[name]; !ok {
+		return fmt.Errorf("%s: %w", name, ErrNodeNotFound)
 	}
 
+	node := chr.Nodes[name]
+	chr.shrinkVnodes(node, 0)
+	chr.totalLoad -= node.Load
+	delete(chr.Nodes, name)
+	chr.publish(RingEvent{Type: NodeRemoved, Node: name, OldCap: node.Cap})
+
 	return nil
 }
+
+// UpdateNodeCapacity 修改节点容量，按新容量增加或删除虚拟节点。
+// 虚拟节点按编号增减，容量变化只会移动新增或删除的那部分虚拟节点上的数据
+func (chr *ConsistentHashingRing) UpdateNodeCapacity(name string, cap int64) error {
+	chr.rwLock.Lock()
+	defer chr.rwLock.Unlock()
+
+	node, ok := chr.Nodes[name]
+	if !ok {
+		return fmt.Errorf("%s: %w", name, ErrNodeNotFound)
+	}
+	if cap < 0 {
+		return fmt.Errorf("bad capacity %d", cap)
+	}
+
+	nr := chr.nrVnodes(cap)
+	if nr > len(node.Vnodes) {
+		chr.growVnodes(node, nr)
+	} else if nr < len(node.Vnodes) {
+		chr.shrinkVnodes(node, nr)
+	}
+	oldCap := node.Cap
+	node.Cap = cap
+	chr.Nodes[name] = node
+	chr.publish(RingEvent{Type: NodeCapacityChanged, Node: name, Cap: cap, OldCap: oldCap})
+
+	return nil
+}
+
+// growVnodes 把节点的虚拟节点增加到nr个，调用者需持有写锁
+func (chr *ConsistentHashingRing) growVnodes(node Node, nr int) {
+	for i := len(node.Vnodes); i < nr; i++ {
+		vnode := Vnode{Hash: chr.vnodeHash(node.Name, i), Node: node.Name, Idx: i}
+		node.Vnodes[vnode.Hash] = vnode
+		chr.Vnodes = append(chr.Vnodes, vnode)
+	}
+	chr.sortVnodes()
+}
+
+// shrinkVnodes 删除节点编号不小于nr的虚拟节点，调用者需持有写锁
+func (chr *ConsistentHashingRing) shrinkVnodes(node Node, nr int) {
+	vnodes := make([]Vnode, 0, len(chr.Vnodes))
+	for _, vnode := range chr.Vnodes {
+		if vnode.Node == node.Name && vnode.Idx >= nr {
+			delete(node.Vnodes, vnode.Hash)
+			continue
+		}
+		vnodes = append(vnodes, vnode)
+	}
+	chr.Vnodes = vnodes
+}
+
+// Locate 返回key在环上顺时针方向遇到的第一个虚拟节点所属的物理节点，
+// bounded load模式下跳过负载已满的节点
+func (chr *ConsistentHashingRing) Locate(key string) (Node, error) {
+	chr.rwLock.RLock()
+	defer chr.rwLock.RUnlock()
+
+	return chr.locate(key)
+}
+
+// 调用者需持有锁
+func (chr *ConsistentHashingRing) locate(key string) (Node, error) {
+	if len(chr.Vnodes) == 0 {
+		return Node{}, ErrEmptyRing
+	}
+
+	start := chr.search(chr.keyHash(key))
+	if !chr.bounded {
+		return chr.Nodes[chr.Vnodes[start].Node], nil
+	}
+
+	limits := chr.loadLimits()
+	for i := 0; i < len(chr.Vnodes); i++ {
+		node := chr.Nodes[chr.Vnodes[(start+i)%len(chr.Vnodes)].Node]
+		if node.Load < limits[node.Name] {
+			return node, nil
+		}
+	}
+	//所有节点容量都为0时才会走到这里
+	return chr.Nodes[chr.Vnodes[start].Node], nil
+}
+
+// LocateN 从key的hash位置顺时针查找n个不同的物理节点，第一个即为Locate的结果
+func (chr *ConsistentHashingRing) LocateN(key string, n int) ([]Node, error) {
+	chr.rwLock.RLock()
+	defer chr.rwLock.RUnlock()
+
+	if len(chr.Vnodes) == 0 {
+		return nil, ErrEmptyRing
+	}
+	if n <= 0 {
+		return nil, fmt.Errorf("bad replica number %d", n)
+	}
+	if n > len(chr.Nodes) {
+		return nil, fmt.Errorf("want %d nodes but ring has %d: %w", n, len(chr.Nodes), ErrNotEnoughNodes)
+	}
+
+	var limits map[string]int64
+	if chr.bounded {
+		limits = chr.loadLimits()
+	}
+
+	nodes := make([]Node, 0, n)
+	full := make([]Node, 0) //bounded load模式下负载已满的节点，不够n个时按顺序补上
+	chosen := make(map[string]struct{}, n)
+	start := chr.search(chr.keyHash(key))
+	for i := 0; i < len(chr.Vnodes) && len(nodes) < n; i++ {
+		vnode := chr.Vnodes[(start+i)%len(chr.Vnodes)]
+		//跳过已选物理节点的虚拟节点
+		if _, ok := chosen[vnode.Node]; ok {
+			continue
+		}
+		chosen[vnode.Node] = struct{}{}
+		node := chr.Nodes[vnode.Node]
+		if chr.bounded && node.Load >= limits[node.Name] {
+			full = append(full, node)
+			continue
+		}
+		nodes = append(nodes, node)
+	}
+	for i := 0; i < len(full) && len(nodes) < n; i++ {
+		nodes = append(nodes, full[i])
+	}
+	//没有虚拟节点的物理节点不参与选择
+	if len(nodes) < n {
+		return nil, fmt.Errorf("want %d nodes but only %d have vnodes: %w", n, len(nodes), ErrNotEnoughNodes)
+	}
+
+	return nodes, nil
+}
+
+// search 返回第一个hash不小于h的虚拟节点下标，超过环尾则回到0，调用者需持有锁
+func (chr *ConsistentHashingRing) search(h uint64) int {
+	idx := sort.Search(len(chr.Vnodes), func(i int) bool {
+		return chr.Vnodes[i].Hash >= h
+	})
+	if idx == len(chr.Vnodes) {
+		idx = 0
+	}
+	return idx
+}
+
+// 调用者需持有写锁
+func (chr *ConsistentHashingRing) sortVnodes() {
+	sort.Slice(chr.Vnodes, func(i, j int) bool {
+		if chr.Vnodes[i].Hash != chr.Vnodes[j].Hash {
+			return chr.Vnodes[i].Hash < chr.Vnodes[j].Hash
+		}
+		//hash冲突时按节点名排序，保证各实例构建出的环一致
+		return chr.Vnodes[i].Node < chr.Vnodes[j].Node
+	})
+}
@@ -0,0 +1,222 @@
+package consistenthashing_test
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	consistenthashing "test/consistentHashing"
+	"testing"
+)
+
+const GiB = 1024 * 1024 * 1024
+
+func newRing(t *testing.T, names ...string) *consistenthashing.ConsistentHashingRing {
+	ring := consistenthashing.NewConsistentHashingRing()
+	for _, name := range names {
+		if err := ring.AddNode(name, 1000*GiB); err != nil {
+			t.Fatalf("add node %s failed with %v", name, err)
+		}
+	}
+	return ring
+}
+
+func TestAddAndLocate(t *testing.T) {
+	ring := consistenthashing.NewConsistentHashingRing()
+	if _, err := ring.Locate("aaa"); !errors.Is(err, consistenthashing.ErrEmptyRing) {
+		t.Fatalf("locate on empty ring want ErrEmptyRing but get %v", err)
+	}
+
+	ring = newRing(t, "cluster-a", "cluster-b", "cluster-c")
+	if err := ring.AddNode("cluster-a", 1000*GiB); err == nil {
+		t.Fatalf("add duplicate node want err but not")
+	}
+	if len(ring.Vnodes) != 300 {
+		t.Fatalf("want 300 vnodes but get %d", len(ring.Vnodes))
+	}
+	for i := 1; i < len(ring.Vnodes); i++ {
+		if ring.Vnodes[i-1].Hash > ring.Vnodes[i].Hash {
+			t.Fatalf("vnodes not sorted at %d", i)
+		}
+	}
+
+	count := make(map[string]int)
+	for i := 0; i < 30000; i++ {
+		key := fmt.Sprintf("traindata/space/user/dataset%d", i)
+		node, err := ring.Locate(key)
+		if err != nil {
+			t.Fatalf("locate %s failed with %v", key, err)
+		}
+		again, _ := ring.Locate(key)
+		if node.Name != again.Name {
+			t.Fatalf("locate %s not stable: %s, %s", key, node.Name, again.Name)
+		}
+		count[node.Name]++
+	}
+	for name, n := range count {
+		if n < 5000 {
+			t.Fatalf("node %s only get %d keys", name, n)
+		}
+		t.Logf("%s: %d", name, n)
+	}
+}
+
+func TestRemoveNode(t *testing.T) {
+	ring := newRing(t, "cluster-a", "cluster-b", "cluster-c")
+	before := make(map[string]string)
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		node, _ := ring.Locate(key)
+		before[key] = node.Name
+	}
+
+	if err := ring.RemoveNode("cluster-b"); err != nil {
+		t.Fatalf("remove node failed with %v", err)
+	}
+	if err := ring.RemoveNode("cluster-b"); !errors.Is(err, consistenthashing.ErrNodeNotFound) {
+		t.Fatalf("remove missing node want ErrNodeNotFound but get %v", err)
+	}
+	if len(ring.Vnodes) != 200 {
+		t.Fatalf("want 200 vnodes but get %d", len(ring.Vnodes))
+	}
+
+	//只有原来属于cluster-b的key会移动
+	for key, name := range before {
+		node, _ := ring.Locate(key)
+		if node.Name == "cluster-b" {
+			t.Fatalf("%s still located on removed node", key)
+		}
+		if name != "cluster-b" && node.Name != name {
+			t.Fatalf("%s moved from %s to %s", key, name, node.Name)
+		}
+	}
+}
+
+func TestConcurrentLocate(t *testing.T) {
+	ring := newRing(t, "cluster-a", "cluster-b")
+	wg := sync.WaitGroup{}
+	for i := 0; i < 8; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 1000; j++ {
+				if _, err := ring.Locate(fmt.Sprintf("%d-%d", i, j)); err != nil {
+					t.Errorf("locate failed with %v", err)
+					return
+				}
+			}
+		}(i)
+	}
+	for i := 0; i < 10; i++ {
+		name := fmt.Sprintf("cluster-%d", i)
+		if err := ring.AddNode(name, 100*GiB); err != nil {
+			t.Fatalf("add node failed with %v", err)
+		}
+		if err := ring.RemoveNode(name); err != nil {
+			t.Fatalf("remove node failed with %v", err)
+		}
+	}
+	wg.Wait()
+}
+
+func TestLocateN(t *testing.T) {
+	ring := newRing(t, "cluster-a", "cluster-b", "cluster-c")
+	if _, err := ring.LocateN("aaa", 4); !errors.Is(err, consistenthashing.ErrNotEnoughNodes) {
+		t.Fatalf("locate 4 nodes want ErrNotEnoughNodes but get %v", err)
+	}
+	if _, err := ring.LocateN("aaa", 0); err == nil {
+		t.Fatalf("locate 0 nodes want err but not")
+	}
+
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		nodes, err := ring.LocateN(key, 3)
+		if err != nil {
+			t.Fatalf("locate n failed with %v", err)
+		}
+		primary, _ := ring.Locate(key)
+		if nodes[0].Name != primary.Name {
+			t.Fatalf("%s first replica %s is not primary %s", key, nodes[0].Name, primary.Name)
+		}
+		seen := make(map[string]bool)
+		for _, node := range nodes {
+			if seen[node.Name] {
+				t.Fatalf("%s get duplicate node %s", key, node.Name)
+			}
+			seen[node.Name] = true
+		}
+	}
+}
+
+func TestMinVnodesAndVnodeCap(t *testing.T) {
+	ring := consistenthashing.NewConsistentHashingRing()
+	if err := ring.AddNode("small", 1*GiB); err != nil {
+		t.Fatalf("add node failed with %v", err)
+	}
+	if len(ring.Nodes["small"].Vnodes) != 1 {
+		t.Fatalf("small node want 1 vnode but get %d", len(ring.Nodes["small"].Vnodes))
+	}
+	if node, err := ring.Locate("aaa"); err != nil || node.Name != "small" {
+		t.Fatalf("locate want small but get %v, %v", node.Name, err)
+	}
+
+	ring = consistenthashing.NewConsistentHashingRing(consistenthashing.WithVnodeCap(1*GiB), consistenthashing.WithMinVnodes(16))
+	if err := ring.AddNode("small", 1*GiB); err != nil {
+		t.Fatalf("add node failed with %v", err)
+	}
+	if err := ring.AddNode("big", 100*GiB); err != nil {
+		t.Fatalf("add node failed with %v", err)
+	}
+	if len(ring.Nodes["small"].Vnodes) != 16 || len(ring.Nodes["big"].Vnodes) != 100 {
+		t.Fatalf("want 16 and 100 vnodes but get %d and %d", len(ring.Nodes["small"].Vnodes), len(ring.Nodes["big"].Vnodes))
+	}
+}
+
+func TestUpdateNodeCapacity(t *testing.T) {
+	ring := newRing(t, "cluster-a", "cluster-b")
+	if err := ring.UpdateNodeCapacity("cluster-c", 10*GiB); !errors.Is(err, consistenthashing.ErrNodeNotFound) {
+		t.Fatalf("update missing node want ErrNodeNotFound but get %v", err)
+	}
+
+	before := make(map[string]string)
+	for i := 0; i < 2000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		node, _ := ring.Locate(key)
+		before[key] = node.Name
+	}
+
+	//扩容，只会有key迁移到cluster-a
+	if err := ring.UpdateNodeCapacity("cluster-a", 2000*GiB); err != nil {
+		t.Fatalf("update capacity failed with %v", err)
+	}
+	if len(ring.Nodes["cluster-a"].Vnodes) != 200 || len(ring.Vnodes) != 300 {
+		t.Fatalf("want 200/300 vnodes but get %d/%d", len(ring.Nodes["cluster-a"].Vnodes), len(ring.Vnodes))
+	}
+	if ring.Nodes["cluster-a"].Cap != 2000*GiB {
+		t.Fatalf("cap not updated")
+	}
+	moved := 0
+	for key, name := range before {
+		node, _ := ring.Locate(key)
+		if node.Name != name {
+			if node.Name != "cluster-a" {
+				t.Fatalf("%s moved from %s to %s", key, name, node.Name)
+			}
+			moved++
+		}
+	}
+	t.Logf("%d keys moved to cluster-a", moved)
+
+	//缩容回原来的容量，环恢复原状
+	if err := ring.UpdateNodeCapacity("cluster-a", 1000*GiB); err != nil {
+		t.Fatalf("update capacity failed with %v", err)
+	}
+	if len(ring.Vnodes) != 200 {
+		t.Fatalf("want 200 vnodes but get %d", len(ring.Vnodes))
+	}
+	for key, name := range before {
+		node, _ := ring.Locate(key)
+		if node.Name != name {
+			t.Fatalf("%s want %s but get %s", key, name, node.Name)
+		}
+	}
+}
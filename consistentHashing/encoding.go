@@ -0,0 +1,291 @@
+package consistenthashing
+
+import (
+	"bytes"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+)
+
+const (
+	encodingVersion = 1
+	binaryMagic     = "CHR"
+)
+
+var ErrBadSnapshot = errors.New("bad ring snapshot")
+
+var builtinHashers = map[string]Hasher{
+	SHA256Hasher.Name():  SHA256Hasher,
+	FNV1a64Hasher.Name(): FNV1a64Hasher,
+	XXHasher.Name():      XXHasher,
+}
+
+// ringSnapshot 是环的稳定编码格式，节点按名字排序、虚拟节点按编号排序，同一个环编码结果相同。
+// 节点负载是运行时状态，不编码
+type ringSnapshot struct {
+	Version   int            `json:"version"`
+	Hasher    string         `json:"hasher"`
+	VnodeCap  int64          `json:"vnode_cap"`
+	MinVnodes int            `json:"min_vnodes"`
+	Bounded   bool           `json:"bounded,omitempty"`
+	Epsilon   float64        `json:"epsilon,omitempty"`
+	Nodes     []nodeSnapshot `json:"nodes"`
+}
+
+type nodeSnapshot struct {
+	Name   string          `json:"name"`
+	Cap    int64           `json:"cap"`
+	Vnodes []vnodeSnapshot `json:"vnodes"`
+}
+
+type vnodeSnapshot struct {
+	Idx  int    `json:"idx"`
+	Hash uint64 `json:"hash"`
+}
+
+// snapshot 调用者需持有锁
+func (chr *ConsistentHashingRing) snapshot() ringSnapshot {
+	snap := ringSnapshot{
+		Version:   encodingVersion,
+		Hasher:    chr.hasher.Name(),
+		VnodeCap:  chr.vnodeCap,
+		MinVnodes: chr.minVnodes,
+		Bounded:   chr.bounded,
+		Epsilon:   chr.epsilon,
+		Nodes:     make([]nodeSnapshot, 0, len(chr.Nodes)),
+	}
+	for _, node := range chr.Nodes {
+		ns := nodeSnapshot{Name: node.Name, Cap: node.Cap, Vnodes: make([]vnodeSnapshot, 0, len(node.Vnodes))}
+		for _, vnode := range node.Vnodes {
+			ns.Vnodes = append(ns.Vnodes, vnodeSnapshot{Idx: vnode.Idx, Hash: vnode.Hash})
+		}
+		sort.Slice(ns.Vnodes, func(i, j int) bool { return ns.Vnodes[i].Idx < ns.Vnodes[j].Idx })
+		snap.Nodes = append(snap.Nodes, ns)
+	}
+	sort.Slice(snap.Nodes, func(i, j int) bool { return snap.Nodes[i].Name < snap.Nodes[j].Name })
+	return snap
+}
+
+// restore 用快照替换环的内容，虚拟节点直接使用快照里的hash，不重新计算，调用者需持有写锁。
+// 每个节点的虚拟节点编号必须正好是0到n-1且hash不重复，否则返回ErrBadSnapshot
+func (chr *ConsistentHashingRing) restore(snap ringSnapshot) error {
+	if snap.Version != encodingVersion {
+		return fmt.Errorf("version %d not support: %w", snap.Version, ErrBadSnapshot)
+	}
+	hasher := chr.hasher
+	if hasher == nil || hasher.Name() != snap.Hasher {
+		h, ok := builtinHashers[snap.Hasher]
+		if !ok {
+			return fmt.Errorf("hasher %s not found, create ring with WithHasher first: %w", snap.Hasher, ErrBadSnapshot)
+		}
+		hasher = h
+	}
+	if snap.VnodeCap <= 0 || snap.MinVnodes <= 0 {
+		return fmt.Errorf("vnode cap %d, min vnodes %d: %w", snap.VnodeCap, snap.MinVnodes, ErrBadSnapshot)
+	}
+
+	nodes := make(map[string]Node, len(snap.Nodes))
+	vnodes := make([]Vnode, 0)
+	for _, ns := range snap.Nodes {
+		if _, ok := nodes[ns.Name]; ok {
+			return fmt.Errorf("duplicate node %s: %w", ns.Name, ErrBadSnapshot)
+		}
+		//growVnodes和shrinkVnodes假设节点的虚拟节点编号为0到n-1
+		node := Node{Name: ns.Name, Cap: ns.Cap, Vnodes: make(map[uint64]Vnode, len(ns.Vnodes))}
+		seen := make([]bool, len(ns.Vnodes))
+		for _, vs := range ns.Vnodes {
+			if vs.Idx < 0 || vs.Idx >= len(ns.Vnodes) || seen[vs.Idx] {
+				return fmt.Errorf("node %s vnode idx %d not in 0..%d or duplicate: %w", ns.Name, vs.Idx, len(ns.Vnodes)-1, ErrBadSnapshot)
+			}
+			seen[vs.Idx] = true
+			if _, ok := node.Vnodes[vs.Hash]; ok {
+				return fmt.Errorf("node %s duplicate vnode hash %d: %w", ns.Name, vs.Hash, ErrBadSnapshot)
+			}
+			vnode := Vnode{Hash: vs.Hash, Node: ns.Name, Idx: vs.Idx}
+			node.Vnodes[vnode.Hash] = vnode
+			vnodes = append(vnodes, vnode)
+		}
+		nodes[ns.Name] = node
+	}
+
+	chr.hasher = hasher
+	chr.vnodeCap = snap.VnodeCap
+	chr.minVnodes = snap.MinVnodes
+	chr.bounded = snap.Bounded
+	chr.epsilon = snap.Epsilon
+	chr.totalLoad = 0
+	chr.Nodes = nodes
+	chr.Vnodes = vnodes
+	chr.sortVnodes()
+	chr.publish(RingEvent{Type: RingRestored})
+
+	return nil
+}
+
+func (chr *ConsistentHashingRing) MarshalJSON() ([]byte, error) {
+	chr.rwLock.RLock()
+	defer chr.rwLock.RUnlock()
+
+	return json.Marshal(chr.snapshot())
+}
+
+// UnmarshalJSON 使用自定义Hasher时，需要先用WithHasher创建环再解码
+func (chr *ConsistentHashingRing) UnmarshalJSON(data []byte) error {
+	var snap ringSnapshot
+	if err := json.Unmarshal(data, &snap); err != nil {
+		return err
+	}
+
+	chr.rwLock.Lock()
+	defer chr.rwLock.Unlock()
+
+	return chr.restore(snap)
+}
+
+// MarshalBinary 紧凑的二进制格式：
+// magic | version | hasher | vnodeCap | minVnodes | bounded | epsilon | 节点数 | 每个节点(name | cap | 虚拟节点数 | 每个虚拟节点(idx | hash))
+// 字符串为varint长度加内容，整数为varint，hash和epsilon为8字节大端
+func (chr *ConsistentHashingRing) MarshalBinary() ([]byte, error) {
+	chr.rwLock.RLock()
+	snap := chr.snapshot()
+	chr.rwLock.RUnlock()
+
+	buf := bytes.NewBufferString(binaryMagic)
+	buf.WriteByte(byte(snap.Version))
+	putString(buf, snap.Hasher)
+	putVarint(buf, snap.VnodeCap)
+	putVarint(buf, int64(snap.MinVnodes))
+	if snap.Bounded {
+		buf.WriteByte(1)
+	} else {
+		buf.WriteByte(0)
+	}
+	putUint64(buf, math.Float64bits(snap.Epsilon))
+	putVarint(buf, int64(len(snap.Nodes)))
+	for _, ns := range snap.Nodes {
+		putString(buf, ns.Name)
+		putVarint(buf, ns.Cap)
+		putVarint(buf, int64(len(ns.Vnodes)))
+		for _, vs := range ns.Vnodes {
+			putVarint(buf, int64(vs.Idx))
+			putUint64(buf, vs.Hash)
+		}
+	}
+
+	return buf.Bytes(), nil
+}
+
+func (chr *ConsistentHashingRing) UnmarshalBinary(data []byte) error {
+	r := bytes.NewReader(data)
+	magic := make([]byte, len(binaryMagic))
+	if _, err := io.ReadFull(r, magic); err != nil || string(magic) != binaryMagic {
+		return fmt.Errorf("bad magic: %w", ErrBadSnapshot)
+	}
+
+	var snap ringSnapshot
+	version, err := r.ReadByte()
+	if err != nil {
+		return fmt.Errorf("read version failed with %v: %w", err, ErrBadSnapshot)
+	}
+	snap.Version = int(version)
+
+	d := decoder{r: r}
+	snap.Hasher = d.string()
+	snap.VnodeCap = d.varint()
+	snap.MinVnodes = int(d.varint())
+	snap.Bounded = d.byte() == 1
+	snap.Epsilon = math.Float64frombits(d.uint64())
+	nrNodes := d.count()
+	for i := 0; i < nrNodes && d.err == nil; i++ {
+		ns := nodeSnapshot{Name: d.string(), Cap: d.varint()}
+		nrVnodes := d.count()
+		for j := 0; j < nrVnodes && d.err == nil; j++ {
+			ns.Vnodes = append(ns.Vnodes, vnodeSnapshot{Idx: int(d.varint()), Hash: d.uint64()})
+		}
+		snap.Nodes = append(snap.Nodes, ns)
+	}
+	if d.err != nil {
+		return fmt.Errorf("decode failed with %v: %w", d.err, ErrBadSnapshot)
+	}
+	if r.Len() != 0 {
+		return fmt.Errorf("%d trailing bytes: %w", r.Len(), ErrBadSnapshot)
+	}
+
+	chr.rwLock.Lock()
+	defer chr.rwLock.Unlock()
+
+	return chr.restore(snap)
+}
+
+func putString(buf *bytes.Buffer, s string) {
+	putVarint(buf, int64(len(s)))
+	buf.WriteString(s)
+}
+
+func putVarint(buf *bytes.Buffer, v int64) {
+	var tmp [binary.MaxVarintLen64]byte
+	buf.Write(tmp[:binary.PutVarint(tmp[:], v)])
+}
+
+func putUint64(buf *bytes.Buffer, v uint64) {
+	var tmp [8]byte
+	binary.BigEndian.PutUint64(tmp[:], v)
+	buf.Write(tmp[:])
+}
+
+// decoder 记录第一个错误，之后的读取都直接返回零值
+type decoder struct {
+	r   *bytes.Reader
+	err error
+}
+
+func (d *decoder) varint() int64 {
+	if d.err != nil {
+		return 0
+	}
+	v, err := binary.ReadVarint(d.r)
+	d.err = err
+	return v
+}
+
+// count 读取一个长度，长度不能超过剩余的字节数
+func (d *decoder) count() int {
+	n := d.varint()
+	if d.err == nil && (n < 0 || n > int64(d.r.Len())) {
+		d.err = fmt.Errorf("bad length %d", n)
+		return 0
+	}
+	return int(n)
+}
+
+func (d *decoder) string() string {
+	n := d.count()
+	if d.err != nil {
+		return ""
+	}
+	b := make([]byte, n)
+	_, d.err = io.ReadFull(d.r, b)
+	return string(b)
+}
+
+func (d *decoder) byte() byte {
+	if d.err != nil {
+		return 0
+	}
+	b, err := d.r.ReadByte()
+	d.err = err
+	return b
+}
+
+func (d *decoder) uint64() uint64 {
+	if d.err != nil {
+		return 0
+	}
+	var tmp [8]byte
+	_, d.err = io.ReadFull(d.r, tmp[:])
+	return binary.BigEndian.Uint64(tmp[:])
+}
@@ -0,0 +1,128 @@
+package consistenthashing_test
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"reflect"
+	consistenthashing "test/consistentHashing"
+	"testing"
+)
+
+func sameRing(t *testing.T, want, got *consistenthashing.ConsistentHashingRing) {
+	if !reflect.DeepEqual(want.Vnodes, got.Vnodes) {
+		t.Fatalf("vnodes not equal")
+	}
+	if !reflect.DeepEqual(want.Nodes, got.Nodes) {
+		t.Fatalf("nodes not equal")
+	}
+	for i := 0; i < 1000; i++ {
+		key := fmt.Sprintf("key-%d", i)
+		a, _ := want.Locate(key)
+		b, _ := got.Locate(key)
+		if a.Name != b.Name {
+			t.Fatalf("%s located on %s and %s", key, a.Name, b.Name)
+		}
+	}
+}
+
+func TestJSONRoundTrip(t *testing.T) {
+	ring := consistenthashing.NewConsistentHashingRing(consistenthashing.WithHasher(consistenthashing.XXHasher), consistenthashing.WithMinVnodes(4))
+	for i, cap := range []int64{1 * GiB, 100 * GiB, 1000 * GiB} {
+		if err := ring.AddNode(fmt.Sprintf("cluster-%d", i), cap); err != nil {
+			t.Fatalf("add node failed with %v", err)
+		}
+	}
+
+	data, err := json.Marshal(ring)
+	if err != nil {
+		t.Fatalf("marshal failed with %v", err)
+	}
+	again, _ := json.Marshal(ring)
+	if string(data) != string(again) {
+		t.Fatalf("marshal not stable")
+	}
+
+	restored := consistenthashing.NewConsistentHashingRing()
+	if err := json.Unmarshal(data, restored); err != nil {
+		t.Fatalf("unmarshal failed with %v", err)
+	}
+	sameRing(t, ring, restored)
+	if restored.KeyHash("aaa") != consistenthashing.XXHasher.Sum64([]byte("aaa")) {
+		t.Fatalf("hasher not restored")
+	}
+
+	//恢复后的环继续按原来的配置工作
+	if err := restored.AddNode("cluster-3", 2*GiB); err != nil {
+		t.Fatalf("add node failed with %v", err)
+	}
+	if len(restored.Nodes["cluster-3"].Vnodes) != 4 {
+		t.Fatalf("min vnodes not restored")
+	}
+}
+
+func TestBinaryRoundTrip(t *testing.T) {
+	ring := newRing(t, "cluster-a", "cluster-b", "cluster-c")
+	data, err := ring.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal failed with %v", err)
+	}
+	jsonData, _ := json.Marshal(ring)
+	t.Logf("binary %d bytes, json %d bytes", len(data), len(jsonData))
+
+	var restored consistenthashing.ConsistentHashingRing
+	if err := restored.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unmarshal failed with %v", err)
+	}
+	sameRing(t, ring, &restored)
+
+	for _, bad := range [][]byte{nil, []byte("CHR"), data[:len(data)-3], append(append([]byte{}, data...), 0)} {
+		if err := restored.UnmarshalBinary(bad); !errors.Is(err, consistenthashing.ErrBadSnapshot) {
+			t.Fatalf("unmarshal bad data want ErrBadSnapshot but get %v", err)
+		}
+	}
+}
+
+type customHasher struct{}
+
+func (customHasher) Name() string { return "custom" }
+
+func (customHasher) Sum64(data []byte) uint64 {
+	return consistenthashing.FNV1a64Hasher.Sum64(data) ^ 0x5a5a
+}
+
+func TestUnmarshalCustomHasher(t *testing.T) {
+	ring := consistenthashing.NewConsistentHashingRing(consistenthashing.WithHasher(customHasher{}))
+	if err := ring.AddNode("cluster-a", 100*GiB); err != nil {
+		t.Fatalf("add node failed with %v", err)
+	}
+	data, _ := json.Marshal(ring)
+
+	if err := json.Unmarshal(data, consistenthashing.NewConsistentHashingRing()); !errors.Is(err, consistenthashing.ErrBadSnapshot) {
+		t.Fatalf("unmarshal unknown hasher want ErrBadSnapshot but get %v", err)
+	}
+	restored := consistenthashing.NewConsistentHashingRing(consistenthashing.WithHasher(customHasher{}))
+	if err := json.Unmarshal(data, restored); err != nil {
+		t.Fatalf("unmarshal failed with %v", err)
+	}
+	sameRing(t, ring, restored)
+}
+
+func TestUnmarshalBadVnodes(t *testing.T) {
+	header := `{"version":1,"hasher":"sha256","vnode_cap":1073741824,"min_vnodes":1,"nodes":[{"name":"cluster-a","cap":3221225472,"vnodes":%s}]}`
+	good := `[{"idx":0,"hash":1},{"idx":1,"hash":2},{"idx":2,"hash":3}]`
+	if err := json.Unmarshal([]byte(fmt.Sprintf(header, good)), consistenthashing.NewConsistentHashingRing()); err != nil {
+		t.Fatalf("unmarshal failed with %v", err)
+	}
+
+	for _, vnodes := range []string{
+		`[{"idx":0,"hash":1},{"idx":1,"hash":1},{"idx":2,"hash":3}]`,  //hash重复
+		`[{"idx":0,"hash":1},{"idx":0,"hash":2},{"idx":2,"hash":3}]`,  //编号重复
+		`[{"idx":0,"hash":1},{"idx":1,"hash":2},{"idx":5,"hash":3}]`,  //编号超出范围
+		`[{"idx":-1,"hash":1},{"idx":1,"hash":2},{"idx":2,"hash":3}]`, //编号为负
+	} {
+		if err := json.Unmarshal([]byte(fmt.Sprintf(header, vnodes)), consistenthashing.NewConsistentHashingRing()); !errors.Is(err, consistenthashing.ErrBadSnapshot) {
+			t.Fatalf("unmarshal %s want ErrBadSnapshot but get %v", vnodes, err)
+		}
+	}
+}
@@ -0,0 +1,90 @@
+package consistenthashing
+
+const defaultEventBuffer = 64
+
+type RingEventType int
+
+const (
+	NodeAdded RingEventType = iota + 1
+	NodeRemoved
+	NodeCapacityChanged
+	RingRestored //从快照恢复，整个环都可能变化
+)
+
+func (t RingEventType) String() string {
+	switch t {
+	case NodeAdded:
+		return "NodeAdded"
+	case NodeRemoved:
+		return "NodeRemoved"
+	case NodeCapacityChanged:
+		return "NodeCapacityChanged"
+	case RingRestored:
+		return "RingRestored"
+	default:
+		return "Unknown"
+	}
+}
+
+type RingEvent struct {
+	Type    RingEventType
+	Node    string
+	Cap     int64  //变化后的容量，删除节点时为0
+	OldCap  int64  //变化前的容量，添加节点时为0
+	Version uint64 //变化后环的版本
+}
+
+// Subscribe 订阅环的成员变化。每个订阅者有独立的缓冲区，缓冲区满时丢弃最旧的事件，
+// 不会阻塞AddNode等操作，订阅者可以通过Version是否连续判断是否丢过事件
+func (chr *ConsistentHashingRing) Subscribe() <-chan RingEvent {
+	chr.rwLock.Lock()
+	defer chr.rwLock.Unlock()
+
+	if chr.subs == nil {
+		chr.subs = make(map[<-chan RingEvent]chan RingEvent)
+	}
+	ch := make(chan RingEvent, defaultEventBuffer)
+	chr.subs[ch] = ch
+	return ch
+}
+
+// Unsubscribe 取消订阅并关闭channel
+func (chr *ConsistentHashingRing) Unsubscribe(sub <-chan RingEvent) {
+	chr.rwLock.Lock()
+	defer chr.rwLock.Unlock()
+
+	if ch, ok := chr.subs[sub]; ok {
+		delete(chr.subs, sub)
+		close(ch)
+	}
+}
+
+// Version 返回环当前的版本，每次成员或容量变化加1
+func (chr *ConsistentHashingRing) Version() uint64 {
+	chr.rwLock.RLock()
+	defer chr.rwLock.RUnlock()
+
+	return chr.version
+}
+
+// publish 增加版本并通知所有订阅者，调用者需持有写锁
+func (chr *ConsistentHashingRing) publish(event RingEvent) {
+	chr.version++
+	event.Version = chr.version
+	for _, ch := range chr.subs {
+		select {
+		case ch <- event:
+			continue
+		default:
+		}
+		//缓冲区满，丢弃最旧的事件
+		select {
+		case <-ch:
+		default:
+		}
+		select {
+		case ch <- event:
+		default:
+		}
+	}
+}
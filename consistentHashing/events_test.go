@@ -0,0 +1,101 @@
+package consistenthashing_test
+
+import (
+	"encoding/json"
+	"fmt"
+	consistenthashing "test/consistentHashing"
+	"testing"
+	"time"
+)
+
+func TestSubscribe(t *testing.T) {
+	ring := consistenthashing.NewConsistentHashingRing()
+	sub := ring.Subscribe()
+
+	if err := ring.AddNode("cluster-a", 100*GiB); err != nil {
+		t.Fatalf("add node failed with %v", err)
+	}
+	if err := ring.UpdateNodeCapacity("cluster-a", 200*GiB); err != nil {
+		t.Fatalf("update capacity failed with %v", err)
+	}
+	if err := ring.RemoveNode("cluster-a"); err != nil {
+		t.Fatalf("remove node failed with %v", err)
+	}
+	//失败的操作不产生事件
+	if err := ring.RemoveNode("cluster-a"); err == nil {
+		t.Fatalf("remove missing node want err but not")
+	}
+
+	want := []consistenthashing.RingEvent{
+		{Type: consistenthashing.NodeAdded, Node: "cluster-a", Cap: 100 * GiB, Version: 1},
+		{Type: consistenthashing.NodeCapacityChanged, Node: "cluster-a", Cap: 200 * GiB, OldCap: 100 * GiB, Version: 2},
+		{Type: consistenthashing.NodeRemoved, Node: "cluster-a", OldCap: 200 * GiB, Version: 3},
+	}
+	for _, w := range want {
+		select {
+		case event := <-sub:
+			if event != w {
+				t.Fatalf("want event %+v but get %+v", w, event)
+			}
+		case <-time.After(time.Second):
+			t.Fatalf("wait event %s timeout", w.Type)
+		}
+	}
+	if ring.Version() != 3 {
+		t.Fatalf("want version 3 but get %d", ring.Version())
+	}
+
+	ring.Unsubscribe(sub)
+	if _, ok := <-sub; ok {
+		t.Fatalf("channel not closed after unsubscribe")
+	}
+}
+
+func TestSlowSubscriber(t *testing.T) {
+	ring := consistenthashing.NewConsistentHashingRing()
+	slow := ring.Subscribe()
+
+	//没有人读取也不会阻塞
+	done := make(chan struct{})
+	go func() {
+		defer close(done)
+		for i := 0; i < 200; i++ {
+			if err := ring.AddNode(fmt.Sprintf("cluster-%d", i), 10*GiB); err != nil {
+				t.Errorf("add node failed with %v", err)
+				return
+			}
+		}
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("add node blocked by slow subscriber")
+	}
+
+	//保留的是最新的事件，版本连续递增
+	var last uint64
+	for len(slow) > 0 {
+		event := <-slow
+		if last != 0 && event.Version != last+1 {
+			t.Fatalf("version jump from %d to %d", last, event.Version)
+		}
+		last = event.Version
+	}
+	if last != ring.Version() || last != 200 {
+		t.Fatalf("last event version %d, ring version %d", last, ring.Version())
+	}
+}
+
+func TestRestoreEvent(t *testing.T) {
+	ring := newRing(t, "cluster-a")
+	data, _ := json.Marshal(ring)
+
+	restored := consistenthashing.NewConsistentHashingRing()
+	sub := restored.Subscribe()
+	if err := json.Unmarshal(data, restored); err != nil {
+		t.Fatalf("unmarshal failed with %v", err)
+	}
+	if event := <-sub; event.Type != consistenthashing.RingRestored || event.Version != 1 {
+		t.Fatalf("want restored event but get %+v", event)
+	}
+}
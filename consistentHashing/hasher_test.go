@@ -0,0 +1,134 @@
+package consistenthashing_test
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	consistenthashing "test/consistentHashing"
+	"testing"
+)
+
+var hashers = []consistenthashing.Hasher{
+	consistenthashing.SHA256Hasher,
+	consistenthashing.FNV1a64Hasher,
+	consistenthashing.XXHasher,
+}
+
+func TestHasherVectors(t *testing.T) {
+	xx := map[string]uint64{
+		"":    0xef46db3751d8e999,
+		"a":   0xd24ec4f1a98c6e5b,
+		"abc": 0x44bc2cf5ad770999,
+		"Nobody inspects the spammish repetition": 0xfbcea83c8a378bf1,
+	}
+	for data, want := range xx {
+		if got := consistenthashing.XXHasher.Sum64([]byte(data)); got != want {
+			t.Fatalf("xxhash64(%q) want %x but get %x", data, want, got)
+		}
+	}
+
+	for _, data := range []string{"", "a", "traindata/space/user/dataset1"} {
+		h := fnv.New64a()
+		h.Write([]byte(data))
+		want := fmix64(h.Sum64())
+		if got := consistenthashing.FNV1a64Hasher.Sum64([]byte(data)); got != want {
+			t.Fatalf("fnv1a64(%q) want %x but get %x", data, want, got)
+		}
+	}
+}
+
+func fmix64(h uint64) uint64 {
+	h ^= h >> 33
+	h *= 0xff51afd7ed558ccd
+	h ^= h >> 33
+	h *= 0xc4ceb9fe1a85ec53
+	h ^= h >> 33
+	return h
+}
+
+func TestWithHasher(t *testing.T) {
+	for _, hasher := range hashers {
+		ring := consistenthashing.NewConsistentHashingRing(consistenthashing.WithHasher(hasher))
+		if err := ring.AddNode("cluster-a", 100*GiB); err != nil {
+			t.Fatalf("add node failed with %v", err)
+		}
+		if h := ring.KeyHash("aaa"); h != hasher.Sum64([]byte("aaa")) {
+			t.Fatalf("%s key hash not used", hasher.Name())
+		}
+	}
+}
+
+// TestHasherDistribution 输出每种hash在环上的均匀程度：
+// 各节点分到的key数的变异系数(标准差/均值)和最大值/均值，以及原始hash分桶的卡方值
+func TestHasherDistribution(t *testing.T) {
+	const (
+		nrNodes = 10
+		nrKeys  = 200000
+		buckets = 1024
+	)
+	for _, hasher := range hashers {
+		ring := consistenthashing.NewConsistentHashingRing(consistenthashing.WithHasher(hasher))
+		for i := 0; i < nrNodes; i++ {
+			if err := ring.AddNode(fmt.Sprintf("cluster-%d", i), 1000*GiB); err != nil {
+				t.Fatalf("add node failed with %v", err)
+			}
+		}
+
+		count := make(map[string]int)
+		bucket := make([]int, buckets)
+		for i := 0; i < nrKeys; i++ {
+			key := fmt.Sprintf("traindata/space/user/dataset%d", i)
+			node, err := ring.Locate(key)
+			if err != nil {
+				t.Fatalf("locate failed with %v", err)
+			}
+			count[node.Name]++
+			bucket[ring.KeyHash(key)>>54]++
+		}
+
+		mean := float64(nrKeys) / nrNodes
+		variance, maxLoad := 0.0, 0
+		for _, n := range count {
+			variance += (float64(n) - mean) * (float64(n) - mean)
+			if n > maxLoad {
+				maxLoad = n
+			}
+		}
+		stddev := math.Sqrt(variance / nrNodes)
+
+		expect := float64(nrKeys) / buckets
+		chi2 := 0.0
+		for _, n := range bucket {
+			chi2 += (float64(n) - expect) * (float64(n) - expect) / expect
+		}
+
+		t.Logf("%-8s nodes cv %.4f, max/mean %.3f, key chi2 %.1f (df %d)",
+			hasher.Name(), stddev/mean, float64(maxLoad)/mean, chi2, buckets-1)
+		if float64(maxLoad)/mean > 1.5 {
+			t.Fatalf("%s distribution too skewed", hasher.Name())
+		}
+	}
+}
+
+func BenchmarkLocate(b *testing.B) {
+	keys := make([]string, 1024)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("traindata/space/user/dataset%d", i)
+	}
+	for _, hasher := range hashers {
+		ring := consistenthashing.NewConsistentHashingRing(consistenthashing.WithHasher(hasher))
+		for i := 0; i < 10; i++ {
+			if err := ring.AddNode(fmt.Sprintf("cluster-%d", i), 1000*GiB); err != nil {
+				b.Fatalf("add node failed with %v", err)
+			}
+		}
+		b.Run(hasher.Name(), func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				if _, err := ring.Locate(keys[i%len(keys)]); err != nil {
+					b.Fatalf("locate failed with %v", err)
+				}
+			}
+		})
+	}
+}
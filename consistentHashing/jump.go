@@ -0,0 +1,107 @@
+package consistenthashing
+
+import (
+	"fmt"
+	"sync"
+)
+
+// JumpHash 是Lamping和Veach的jump consistent hash，不需要额外内存，分布非常均匀，
+// 但只支持编号连续的桶：删除非最后一个节点时，最后一个节点会移动到被删除的位置，它上面的key也会迁移。
+// 节点容量不参与计算
+type JumpHash struct {
+	rwLock sync.RWMutex
+	hasher Hasher
+	nodes  []Node
+	index  map[string]int //key is node name, value is bucket
+}
+
+func NewJumpHash() *JumpHash {
+	return &JumpHash{hasher: SHA256Hasher, index: make(map[string]int)}
+}
+
+func (jh *JumpHash) Add(name string, cap int64) error {
+	jh.rwLock.Lock()
+	defer jh.rwLock.Unlock()
+
+	if _, ok := jh.index[name]; ok {
+		return fmt.Errorf("%s already exist", name)
+	}
+	jh.index[name] = len(jh.nodes)
+	jh.nodes = append(jh.nodes, Node{Name: name, Cap: cap})
+	return nil
+}
+
+func (jh *JumpHash) Remove(name string) error {
+	jh.rwLock.Lock()
+	defer jh.rwLock.Unlock()
+
+	idx, ok := jh.index[name]
+	if !ok {
+		return fmt.Errorf("%s: %w", name, ErrNodeNotFound)
+	}
+	last := len(jh.nodes) - 1
+	if idx != last {
+		jh.nodes[idx] = jh.nodes[last]
+		jh.index[jh.nodes[idx].Name] = idx
+	}
+	jh.nodes = jh.nodes[:last]
+	delete(jh.index, name)
+	return nil
+}
+
+func (jh *JumpHash) Locate(key string) (Node, error) {
+	jh.rwLock.RLock()
+	defer jh.rwLock.RUnlock()
+
+	if len(jh.nodes) == 0 {
+		return Node{}, ErrEmptyRing
+	}
+	return jh.nodes[jump(jh.hasher.Sum64([]byte(key)), len(jh.nodes))], nil
+}
+
+// LocateN 依次用key的hash派生出新的hash做jump，直到选出n个不同的桶
+func (jh *JumpHash) LocateN(key string, n int) ([]Node, error) {
+	jh.rwLock.RLock()
+	defer jh.rwLock.RUnlock()
+
+	if err := checkLocateN(n, len(jh.nodes)); err != nil {
+		return nil, err
+	}
+
+	nodes := make([]Node, 0, n)
+	chosen := make(map[int]struct{}, n)
+	h := jh.hasher.Sum64([]byte(key))
+	for i := 0; len(nodes) < n && i < 16*len(jh.nodes); i++ {
+		b := jump(h, len(jh.nodes))
+		if _, ok := chosen[b]; !ok {
+			chosen[b] = struct{}{}
+			nodes = append(nodes, jh.nodes[b])
+		}
+		h = splitmix64(h)
+	}
+	//多次都落在已选的桶上时，按桶编号顺序补齐
+	for b := 0; len(nodes) < n; b++ {
+		if _, ok := chosen[b]; !ok {
+			chosen[b] = struct{}{}
+			nodes = append(nodes, jh.nodes[b])
+		}
+	}
+	return nodes, nil
+}
+
+func jump(key uint64, buckets int) int {
+	b, j := int64(-1), int64(0)
+	for j < int64(buckets) {
+		b = j
+		key = key*2862933555777941757 + 1
+		j = int64(float64(b+1) * (float64(int64(1)<<31) / float64((key>>33)+1)))
+	}
+	return int(b)
+}
+
+func splitmix64(x uint64) uint64 {
+	x += 0x9e3779b97f4a7c15
+	x = (x ^ (x >> 30)) * 0xbf58476d1ce4e5b9
+	x = (x ^ (x >> 27)) * 0x94d049bb133111eb
+	return x ^ (x >> 31)
+}
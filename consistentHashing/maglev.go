@@ -0,0 +1,147 @@
+package consistenthashing
+
+import (
+	"fmt"
+	"sort"
+	"sync"
+)
+
+const DefaultMaglevTableSize = 65537
+
+// MaglevHash 是Google Maglev负载均衡使用的查找表算法，查找是O(1)，各节点分到的槽位数最多相差1，
+// 增删节点时需要重建查找表，移动的key比环和HRW略多。节点容量不参与计算
+type MaglevHash struct {
+	rwLock sync.RWMutex
+	hasher Hasher
+	size   int
+	nodes  map[string]Node
+	names  []string //按名字排序，保证各实例构建的表相同
+	table  []int    //槽位 -> names的下标
+}
+
+// NewMaglevHash size是查找表大小，必须是质数，建议远大于节点数(100倍以上)，传0使用DefaultMaglevTableSize
+func NewMaglevHash(size int) (*MaglevHash, error) {
+	if size == 0 {
+		size = DefaultMaglevTableSize
+	}
+	if !isPrime(size) {
+		return nil, fmt.Errorf("table size %d is not prime", size)
+	}
+	return &MaglevHash{hasher: SHA256Hasher, size: size, nodes: make(map[string]Node)}, nil
+}
+
+func (mh *MaglevHash) Add(name string, cap int64) error {
+	mh.rwLock.Lock()
+	defer mh.rwLock.Unlock()
+
+	if _, ok := mh.nodes[name]; ok {
+		return fmt.Errorf("%s already exist", name)
+	}
+	if len(mh.nodes)+1 >= mh.size {
+		return fmt.Errorf("table size %d too small for %d nodes", mh.size, len(mh.nodes)+1)
+	}
+	mh.nodes[name] = Node{Name: name, Cap: cap}
+	mh.populate()
+	return nil
+}
+
+func (mh *MaglevHash) Remove(name string) error {
+	mh.rwLock.Lock()
+	defer mh.rwLock.Unlock()
+
+	if _, ok := mh.nodes[name]; !ok {
+		return fmt.Errorf("%s: %w", name, ErrNodeNotFound)
+	}
+	delete(mh.nodes, name)
+	mh.populate()
+	return nil
+}
+
+// populate 重建查找表，每个节点按自己的排列轮流抢占空槽位，调用者需持有写锁
+func (mh *MaglevHash) populate() {
+	mh.names = mh.names[:0]
+	for name := range mh.nodes {
+		mh.names = append(mh.names, name)
+	}
+	sort.Strings(mh.names)
+	if len(mh.names) == 0 {
+		mh.table = nil
+		return
+	}
+
+	size := uint64(mh.size)
+	offsets := make([]uint64, len(mh.names))
+	skips := make([]uint64, len(mh.names))
+	next := make([]uint64, len(mh.names))
+	for i, name := range mh.names {
+		offsets[i] = mh.hasher.Sum64([]byte(name)) % size
+		skips[i] = mh.hasher.Sum64([]byte(name+"\x00skip"))%(size-1) + 1
+	}
+
+	table := make([]int, mh.size)
+	for i := range table {
+		table[i] = -1
+	}
+	for filled := 0; ; {
+		for i := range mh.names {
+			slot := (offsets[i] + next[i]*skips[i]) % size
+			for table[slot] >= 0 {
+				next[i]++
+				slot = (offsets[i] + next[i]*skips[i]) % size
+			}
+			table[slot] = i
+			next[i]++
+			filled++
+			if filled == mh.size {
+				mh.table = table
+				return
+			}
+		}
+	}
+}
+
+func (mh *MaglevHash) Locate(key string) (Node, error) {
+	mh.rwLock.RLock()
+	defer mh.rwLock.RUnlock()
+
+	if len(mh.table) == 0 {
+		return Node{}, ErrEmptyRing
+	}
+	slot := mh.hasher.Sum64([]byte(key)) % uint64(mh.size)
+	return mh.nodes[mh.names[mh.table[slot]]], nil
+}
+
+// LocateN 从key所在槽位往后找n个不同的节点
+func (mh *MaglevHash) LocateN(key string, n int) ([]Node, error) {
+	mh.rwLock.RLock()
+	defer mh.rwLock.RUnlock()
+
+	if err := checkLocateN(n, len(mh.names)); err != nil {
+		return nil, err
+	}
+
+	nodes := make([]Node, 0, n)
+	chosen := make(map[int]struct{}, n)
+	slot := int(mh.hasher.Sum64([]byte(key)) % uint64(mh.size))
+	for i := 0; i < mh.size && len(nodes) < n; i++ {
+		idx := mh.table[(slot+i)%mh.size]
+		if _, ok := chosen[idx]; ok {
+			continue
+		}
+		chosen[idx] = struct{}{}
+		nodes = append(nodes, mh.nodes[mh.names[idx]])
+	}
+	return nodes, nil
+}
+
+func isPrime(n int) bool {
+	if n < 2 {
+		return false
+	}
+	for i := 2; i*i <= n; i++ {
+		if n%i == 0 {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,115 @@
+package consistenthashing
+
+import "sort"
+
+// Move 表示一段hash区间(Start, End]的归属从From节点变为To节点。
+// Start >= End 时区间跨过环尾，即(Start, MaxUint64]和[0, End]。
+// 节点名为空表示该区间在对应的环上没有归属（环为空）
+type Move struct {
+	Start uint64
+	End   uint64
+	From  string
+	To    string
+}
+
+// Contains 判断hash是否落在区间内
+func (m Move) Contains(h uint64) bool {
+	if m.Start < m.End {
+		return h > m.Start && h <= m.End
+	}
+	return h > m.Start || h <= m.End
+}
+
+// Clone 复制当前环，修改成员前保存一份，之后用Diff计算迁移计划
+func (chr *ConsistentHashingRing) Clone() *ConsistentHashingRing {
+	chr.rwLock.RLock()
+	defer chr.rwLock.RUnlock()
+
+	clone := &ConsistentHashingRing{
+		hasher:    chr.hasher,
+		vnodeCap:  chr.vnodeCap,
+		minVnodes: chr.minVnodes,
+		bounded:   chr.bounded,
+		epsilon:   chr.epsilon,
+		totalLoad: chr.totalLoad,
+		version:   chr.version,
+		Nodes:     make(map[string]Node, len(chr.Nodes)),
+		Vnodes:    make([]Vnode, len(chr.Vnodes)),
+	}
+	copy(clone.Vnodes, chr.Vnodes)
+	for name, node := range chr.Nodes {
+		vnodes := make(map[uint64]Vnode, len(node.Vnodes))
+		for h, vnode := range node.Vnodes {
+			vnodes[h] = vnode
+		}
+		node.Vnodes = vnodes
+		clone.Nodes[name] = node
+	}
+	return clone
+}
+
+// KeyHash 返回key在环上的位置，用于和Move的区间比较
+func (chr *ConsistentHashingRing) KeyHash(key string) uint64 {
+	return chr.keyHash(key)
+}
+
+// Diff 比较两个环，返回所有归属发生变化的hash区间，按区间终点升序排列，相邻且迁移方向相同的区间会合并。
+// 两个环需要使用相同的Hasher
+func Diff(oldRing, newRing *ConsistentHashingRing) []Move {
+	oldRing.rwLock.RLock()
+	defer oldRing.rwLock.RUnlock()
+	if oldRing != newRing {
+		newRing.rwLock.RLock()
+		defer newRing.rwLock.RUnlock()
+	}
+
+	//两个环所有虚拟节点的位置把环切成若干区间，每个区间内的归属在两个环上都不变
+	boundarySet := make(map[uint64]struct{}, len(oldRing.Vnodes)+len(newRing.Vnodes))
+	for _, vnode := range oldRing.Vnodes {
+		boundarySet[vnode.Hash] = struct{}{}
+	}
+	for _, vnode := range newRing.Vnodes {
+		boundarySet[vnode.Hash] = struct{}{}
+	}
+	if len(boundarySet) == 0 {
+		return nil
+	}
+	boundaries := make([]uint64, 0, len(boundarySet))
+	for h := range boundarySet {
+		boundaries = append(boundaries, h)
+	}
+	sort.Slice(boundaries, func(i, j int) bool { return boundaries[i] < boundaries[j] })
+
+	moves := make([]Move, 0)
+	for i, end := range boundaries {
+		start := boundaries[(i+len(boundaries)-1)%len(boundaries)]
+		from, to := oldRing.owner(end), newRing.owner(end)
+		if from == to {
+			continue
+		}
+		if n := len(moves); n > 0 && moves[n-1].End == start && moves[n-1].From == from && moves[n-1].To == to {
+			moves[n-1].End = end
+			continue
+		}
+		moves = append(moves, Move{Start: start, End: end, From: from, To: to})
+	}
+
+	//首尾区间在环上相邻时合并
+	if n := len(moves); n > 1 {
+		first, last := moves[0], moves[n-1]
+		if last.End == first.Start && last.From == first.From && last.To == first.To {
+			moves[0].Start = last.Start
+			moves = moves[:n-1]
+		}
+	}
+
+	return moves
+}
+
+// owner 返回hash为h的位置归属的节点名，环为空时返回空字符串，调用者需持有锁
+func (chr *ConsistentHashingRing) owner(h uint64) string {
+	if len(chr.Vnodes) == 0 {
+		return ""
+	}
+	return chr.Vnodes[chr.search(h)].Node
+}
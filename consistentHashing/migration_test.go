@@ -0,0 +1,92 @@
+package consistenthashing_test
+
+import (
+	"fmt"
+	consistenthashing "test/consistentHashing"
+	"testing"
+)
+
+func checkMoves(t *testing.T, oldRing, newRing *consistenthashing.ConsistentHashingRing) []consistenthashing.Move {
+	moves := consistenthashing.Diff(oldRing, newRing)
+	for i := 0; i < 20000; i++ {
+		key := fmt.Sprintf("traindata/space/user/dataset%d", i)
+		from, _ := oldRing.Locate(key)
+		to, _ := newRing.Locate(key)
+		h := newRing.KeyHash(key)
+
+		var hit []consistenthashing.Move
+		for _, move := range moves {
+			if move.Contains(h) {
+				hit = append(hit, move)
+			}
+		}
+		if from.Name == to.Name {
+			if len(hit) != 0 {
+				t.Fatalf("%s not moved but in move %+v", key, hit[0])
+			}
+			continue
+		}
+		if len(hit) != 1 {
+			t.Fatalf("%s moved from %s to %s but in %d moves", key, from.Name, to.Name, len(hit))
+		}
+		if hit[0].From != from.Name || hit[0].To != to.Name {
+			t.Fatalf("%s moved from %s to %s but move is %+v", key, from.Name, to.Name, hit[0])
+		}
+	}
+	return moves
+}
+
+func TestDiffAddNode(t *testing.T) {
+	ring := newRing(t, "cluster-a", "cluster-b", "cluster-c")
+	oldRing := ring.Clone()
+	if err := ring.AddNode("cluster-d", 1000*GiB); err != nil {
+		t.Fatalf("add node failed with %v", err)
+	}
+	if len(oldRing.Nodes) != 3 || len(oldRing.Vnodes) != 300 {
+		t.Fatalf("clone changed with ring")
+	}
+
+	moves := checkMoves(t, oldRing, ring)
+	for _, move := range moves {
+		if move.To != "cluster-d" {
+			t.Fatalf("add node get move %+v", move)
+		}
+	}
+	t.Logf("add node get %d moves", len(moves))
+}
+
+func TestDiffRemoveAndUpdate(t *testing.T) {
+	ring := newRing(t, "cluster-a", "cluster-b", "cluster-c")
+	oldRing := ring.Clone()
+	if err := ring.RemoveNode("cluster-b"); err != nil {
+		t.Fatalf("remove node failed with %v", err)
+	}
+	moves := checkMoves(t, oldRing, ring)
+	for _, move := range moves {
+		if move.From != "cluster-b" {
+			t.Fatalf("remove node get move %+v", move)
+		}
+	}
+
+	oldRing = ring.Clone()
+	if err := ring.UpdateNodeCapacity("cluster-a", 500*GiB); err != nil {
+		t.Fatalf("update capacity failed with %v", err)
+	}
+	checkMoves(t, oldRing, ring)
+
+	if moves := consistenthashing.Diff(ring, ring.Clone()); len(moves) != 0 {
+		t.Fatalf("same ring get %d moves", len(moves))
+	}
+}
+
+func TestDiffEmptyRing(t *testing.T) {
+	empty := consistenthashing.NewConsistentHashingRing()
+	ring := newRing(t, "cluster-a")
+	moves := consistenthashing.Diff(empty, ring)
+	if len(moves) != 1 || moves[0].From != "" || moves[0].To != "cluster-a" {
+		t.Fatalf("want one move from empty ring but get %+v", moves)
+	}
+	if !moves[0].Contains(0) || !moves[0].Contains(^uint64(0)) {
+		t.Fatalf("move from empty ring should cover whole ring: %+v", moves[0])
+	}
+}
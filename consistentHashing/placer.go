@@ -0,0 +1,41 @@
+package consistenthashing
+
+import "fmt"
+
+// Placer 是各种放置算法的公共接口，Locate返回key的主节点，LocateN返回n个不同的节点，第一个和Locate相同。
+// 返回的Node只有Name和Cap有意义，Vnodes只有ConsistentHashingRing会填充
+type Placer interface {
+	Add(name string, cap int64) error
+	Remove(name string) error
+	Locate(key string) (Node, error)
+	LocateN(key string, n int) ([]Node, error)
+}
+
+var (
+	_ Placer = (*ConsistentHashingRing)(nil)
+	_ Placer = (*JumpHash)(nil)
+	_ Placer = (*RendezvousHash)(nil)
+	_ Placer = (*MaglevHash)(nil)
+)
+
+func (chr *ConsistentHashingRing) Add(name string, cap int64) error {
+	return chr.AddNode(name, cap)
+}
+
+func (chr *ConsistentHashingRing) Remove(name string) error {
+	return chr.RemoveNode(name)
+}
+
+// checkLocateN 检查LocateN的参数
+func checkLocateN(n, nrNodes int) error {
+	if nrNodes == 0 {
+		return ErrEmptyRing
+	}
+	if n <= 0 {
+		return fmt.Errorf("bad replica number %d", n)
+	}
+	if n > nrNodes {
+		return fmt.Errorf("want %d nodes but only %d: %w", n, nrNodes, ErrNotEnoughNodes)
+	}
+	return nil
+}
@@ -0,0 +1,138 @@
+package consistenthashing_test
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	consistenthashing "test/consistentHashing"
+	"testing"
+)
+
+func newPlacers(t *testing.T) map[string]consistenthashing.Placer {
+	maglev, err := consistenthashing.NewMaglevHash(0)
+	if err != nil {
+		t.Fatalf("create maglev failed with %v", err)
+	}
+	return map[string]consistenthashing.Placer{
+		"ring":       consistenthashing.NewConsistentHashingRing(consistenthashing.WithVnodeCap(1 * GiB)),
+		"jump":       consistenthashing.NewJumpHash(),
+		"rendezvous": consistenthashing.NewRendezvousHash(),
+		"maglev":     maglev,
+	}
+}
+
+func TestPlacerBasic(t *testing.T) {
+	for name, placer := range newPlacers(t) {
+		if _, err := placer.Locate("aaa"); !errors.Is(err, consistenthashing.ErrEmptyRing) {
+			t.Fatalf("%s locate on empty want ErrEmptyRing but get %v", name, err)
+		}
+		for i := 0; i < 5; i++ {
+			if err := placer.Add(fmt.Sprintf("cluster-%d", i), 100*GiB); err != nil {
+				t.Fatalf("%s add failed with %v", name, err)
+			}
+		}
+		if err := placer.Add("cluster-0", 100*GiB); err == nil {
+			t.Fatalf("%s add duplicate want err but not", name)
+		}
+		if err := placer.Remove("cluster-9"); !errors.Is(err, consistenthashing.ErrNodeNotFound) {
+			t.Fatalf("%s remove missing want ErrNodeNotFound but get %v", name, err)
+		}
+		if _, err := placer.LocateN("aaa", 6); !errors.Is(err, consistenthashing.ErrNotEnoughNodes) {
+			t.Fatalf("%s locate 6 want ErrNotEnoughNodes but get %v", name, err)
+		}
+
+		for i := 0; i < 1000; i++ {
+			key := fmt.Sprintf("key-%d", i)
+			primary, err := placer.Locate(key)
+			if err != nil {
+				t.Fatalf("%s locate failed with %v", name, err)
+			}
+			nodes, err := placer.LocateN(key, 5)
+			if err != nil {
+				t.Fatalf("%s locate n failed with %v", name, err)
+			}
+			if nodes[0].Name != primary.Name {
+				t.Fatalf("%s first of locate n %s is not primary %s", name, nodes[0].Name, primary.Name)
+			}
+			seen := make(map[string]bool)
+			for _, node := range nodes {
+				if seen[node.Name] {
+					t.Fatalf("%s locate n get duplicate %s", name, node.Name)
+				}
+				seen[node.Name] = true
+			}
+		}
+	}
+}
+
+func placeAll(t *testing.T, placer consistenthashing.Placer, keys []string) map[string]string {
+	owners := make(map[string]string, len(keys))
+	for _, key := range keys {
+		node, err := placer.Locate(key)
+		if err != nil {
+			t.Fatalf("locate failed with %v", err)
+		}
+		owners[key] = node.Name
+	}
+	return owners
+}
+
+func moved(before, after map[string]string) float64 {
+	n := 0
+	for key, name := range before {
+		if after[key] != name {
+			n++
+		}
+	}
+	return float64(n) / float64(len(before))
+}
+
+// TestPlacerComparison 输出各算法的负载变异系数(标准差/均值)和增删节点时迁移的key比例，
+// 10个节点时加一个节点理想的迁移比例是1/11，删一个节点是1/10
+func TestPlacerComparison(t *testing.T) {
+	const (
+		nrNodes = 10
+		nrKeys  = 100000
+	)
+	keys := make([]string, nrKeys)
+	for i := range keys {
+		keys[i] = fmt.Sprintf("traindata/space/user/dataset%d", i)
+	}
+
+	for name, placer := range newPlacers(t) {
+		for i := 0; i < nrNodes; i++ {
+			if err := placer.Add(fmt.Sprintf("cluster-%d", i), 100*GiB); err != nil {
+				t.Fatalf("%s add failed with %v", name, err)
+			}
+		}
+		before := placeAll(t, placer, keys)
+
+		count := make(map[string]int)
+		for _, owner := range before {
+			count[owner]++
+		}
+		mean := float64(nrKeys) / nrNodes
+		variance := 0.0
+		for _, n := range count {
+			variance += (float64(n) - mean) * (float64(n) - mean)
+		}
+		cv := math.Sqrt(variance/nrNodes) / mean
+
+		if err := placer.Add("cluster-new", 100*GiB); err != nil {
+			t.Fatalf("%s add failed with %v", name, err)
+		}
+		added := placeAll(t, placer, keys)
+		addMoved := moved(before, added)
+
+		if err := placer.Remove("cluster-3"); err != nil {
+			t.Fatalf("%s remove failed with %v", name, err)
+		}
+		removed := placeAll(t, placer, keys)
+		removeMoved := moved(added, removed)
+
+		t.Logf("%-10s load cv %.4f, add node moved %.4f, remove node moved %.4f", name, cv, addMoved, removeMoved)
+		if addMoved > 0.2 {
+			t.Fatalf("%s add node moved too many keys", name)
+		}
+	}
+}
@@ -0,0 +1,93 @@
+package consistenthashing
+
+import (
+	"fmt"
+	"math"
+	"sort"
+	"sync"
+)
+
+// RendezvousHash 是按容量加权的最高随机权重(HRW)算法，每个节点对key打分，分数最高的节点胜出。
+// 查找是O(节点数)，增删节点只会移动新节点赢得或旧节点持有的key
+type RendezvousHash struct {
+	rwLock sync.RWMutex
+	hasher Hasher
+	nodes  map[string]Node
+}
+
+func NewRendezvousHash() *RendezvousHash {
+	return &RendezvousHash{hasher: SHA256Hasher, nodes: make(map[string]Node)}
+}
+
+func (rh *RendezvousHash) Add(name string, cap int64) error {
+	rh.rwLock.Lock()
+	defer rh.rwLock.Unlock()
+
+	if _, ok := rh.nodes[name]; ok {
+		return fmt.Errorf("%s already exist", name)
+	}
+	rh.nodes[name] = Node{Name: name, Cap: cap}
+	return nil
+}
+
+func (rh *RendezvousHash) Remove(name string) error {
+	rh.rwLock.Lock()
+	defer rh.rwLock.Unlock()
+
+	if _, ok := rh.nodes[name]; !ok {
+		return fmt.Errorf("%s: %w", name, ErrNodeNotFound)
+	}
+	delete(rh.nodes, name)
+	return nil
+}
+
+// score 加权打分 -w/ln(u)，u是(0,1)内由key和节点名决定的均匀随机数，
+// 这样每个节点胜出的概率与权重成正比
+func (rh *RendezvousHash) score(key string, node Node) float64 {
+	h := rh.hasher.Sum64([]byte(node.Name + "\x00" + key))
+	u := (float64(h>>11) + 0.5) / (1 << 53)
+	w := float64(node.Cap)
+	if w <= 0 {
+		w = 1
+	}
+	return -w / math.Log(u)
+}
+
+func (rh *RendezvousHash) Locate(key string) (Node, error) {
+	nodes, err := rh.LocateN(key, 1)
+	if err != nil {
+		return Node{}, err
+	}
+	return nodes[0], nil
+}
+
+// LocateN 返回分数最高的n个节点
+func (rh *RendezvousHash) LocateN(key string, n int) ([]Node, error) {
+	rh.rwLock.RLock()
+	defer rh.rwLock.RUnlock()
+
+	if err := checkLocateN(n, len(rh.nodes)); err != nil {
+		return nil, err
+	}
+
+	type scored struct {
+		node  Node
+		score float64
+	}
+	all := make([]scored, 0, len(rh.nodes))
+	for _, node := range rh.nodes {
+		all = append(all, scored{node: node, score: rh.score(key, node)})
+	}
+	sort.Slice(all, func(i, j int) bool {
+		if all[i].score != all[j].score {
+			return all[i].score > all[j].score
+		}
+		return all[i].node.Name < all[j].node.Name
+	})
+
+	nodes := make([]Node, 0, n)
+	for i := 0; i < n; i++ {
+		nodes = append(nodes, all[i].node)
+	}
+	return nodes, nil
+}
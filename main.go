@@ -2,8 +2,6 @@ package main
 
 import (
 	"context"
-	"crypto/aes"
-	"crypto/cipher"
 	"crypto/tls"
 	"encoding/json"
 	"errors"
@@ -16,7 +14,8 @@ import (
 	"runtime"
 	"strconv"
 	"strings"
-	"sync"
+	"test/mycrypto"
+	"test/threadpool"
 	"time"
 )
 
@@ -344,23 +343,18 @@ func Encrypt(src, dst, passwd string) error {
 	}
 	defer encryptedZipFile.Close()
 
-	block, err := aes.NewCipher([]byte(passwd))
+	// passwd可以是任意长度的口令
+	writer, err := mycrypto.NewEncryptWriter(encryptedZipFile, mycrypto.AES256, []byte(passwd))
 	if err != nil {
 		return err
 	}
 
-	var iv [aes.BlockSize]byte
-
-	// 创建一个 AES 加密流
-	stream := cipher.NewOFB(block, iv[:])
-	writer := &cipher.StreamWriter{S: stream, W: encryptedZipFile}
-
 	_, err = io.Copy(writer, zipFile)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return writer.Close()
 }
 
 func TurnToBashString(src string) string {
@@ -376,44 +370,24 @@ func TurnToBashString(src string) string {
 	return src
 }
 
-func workerA(num int, ch chan struct{}, wg *sync.WaitGroup) {
+func workerA(num int) error {
 	fmt.Println(num, "start")
 	sleepTime := num/3 + 1
 	time.Sleep(time.Duration(sleepTime))
 	fmt.Println(num, "end")
-	ch <- struct{}{}
-	wg.Done()
+	return nil
 }
 
-func dealWithOfflineSyncData(worker func(int, chan struct{}, *sync.WaitGroup), maxThreads, total int) {
-	if maxThreads >= total {
-		maxThreads = total
-	}
-
-	wg := sync.WaitGroup{}
-	wg.Add(total)
-	ch := make(chan struct{}, maxThreads)
-	processed := 0
-	done := 0
-
-	for i := 0; i < maxThreads; i++ {
-		processed++
-		go worker(i, ch, &wg)
+// dealWithOfflineSyncData 最多maxThreads个协程并发处理total个数据，所有数据都会处理，返回所有错误
+func dealWithOfflineSyncData(worker func(int) error, maxThreads, total int) error {
+	nums := make([]int, total)
+	for i := range nums {
+		nums[i] = i
 	}
 
-	for {
-		<-ch
-		done++
-
-		if processed >= total {
-			break
-		}
-
-		processed++
-		go worker(maxThreads+done-1, ch, &wg)
-	}
-
-	wg.Wait()
+	return threadpool.ForEachLimit(context.Background(), nums, maxThreads, func(ctx context.Context, idx int, num int) error {
+		return worker(num)
+	}, threadpool.CollectAll)
 }
 
 func TurnOldRealPathToLogicalPath(path string) (string, string, error) {
@@ -607,5 +581,7 @@ func main() {
 	// 	file.Close()
 	// }
 
-	dealWithOfflineSyncData(workerA, 8, 12)
+	if err := dealWithOfflineSyncData(workerA, 8, 12); err != nil {
+		fmt.Println("error: ", err)
+	}
 }
@@ -0,0 +1,53 @@
+package mongodb
+
+import (
+	"errors"
+	"fmt"
+	consistenthashing "test/consistentHashing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// RingSnapshot 保存一致性hash环的二进制快照，所有服务实例从同一份快照构建出相同的环
+type RingSnapshot struct {
+	Name       string    `bson:"name"`        //环的名字，唯一索引
+	Data       []byte    `bson:"data"`        //MarshalBinary的结果
+	UpdateTime time.Time `bson:"update_time"` //更新时间
+}
+
+func (m *RingSnapshot) TableName() string {
+	return "ring"
+}
+
+// Save 把环的当前状态写入mongodb，已存在则覆盖
+func (m *RingSnapshot) Save(ring *consistenthashing.ConsistentHashingRing) error {
+	if m.Name == "" {
+		return errors.New("name cannot be empty")
+	}
+	data, err := ring.MarshalBinary()
+	if err != nil {
+		return err
+	}
+	m.Data = data
+	m.UpdateTime = time.Now()
+
+	update := bson.M{"$set": bson.M{"data": m.Data, "update_time": m.UpdateTime}}
+	if err := Upsert("pavostor", m.TableName(), bson.M{"name": m.Name}, update); err != nil {
+		fmt.Println("save ring error", "error", err, "name", m.Name)
+		return err
+	}
+	return nil
+}
+
+// Load 从mongodb读取快照并恢复到ring，使用自定义Hasher时ring需要先用WithHasher创建
+func (m *RingSnapshot) Load(ring *consistenthashing.ConsistentHashingRing) error {
+	if m.Name == "" {
+		return errors.New("name cannot be empty")
+	}
+	if err := FindOne("pavostor", m.TableName(), bson.M{"name": m.Name}, nil, m); err != nil {
+		fmt.Println("load ring error", "error", err, "name", m.Name)
+		return err
+	}
+	return ring.UnmarshalBinary(m.Data)
+}
@@ -3,6 +3,7 @@ package mongodb
 import (
 	"errors"
 	"fmt"
+	consistenthashing "test/consistentHashing"
 	"time"
 
 	"go.mongodb.org/mongo-driver/mongo"
@@ -52,6 +53,67 @@ func (m *Task) GetClearClusterId() string {
 	return m.PrimaryClusterId
 }
 
+// PlaceCluster 根据主操作逻辑路径在一致性hash环上选择主操作集群
+func (m *Task) PlaceCluster(ring *consistenthashing.ConsistentHashingRing) error {
+	if m.PrimaryLogicalPath == "" {
+		return errors.New("primary_logical_path cannot be empty")
+	}
+	node, err := ring.Locate(m.PrimaryLogicalPath)
+	if err != nil {
+		return err
+	}
+	m.PrimaryClusterId = node.Name
+	return nil
+}
+
+// AcquireCluster 和PlaceCluster一样选择主操作集群，同时占用该集群的一份负载，
+// 环开启bounded load时负载已满的集群不会再被选中，任务结束后需要调用ReleaseCluster
+func (m *Task) AcquireCluster(ring *consistenthashing.ConsistentHashingRing) error {
+	if m.PrimaryLogicalPath == "" {
+		return errors.New("primary_logical_path cannot be empty")
+	}
+	node, err := ring.Acquire(m.PrimaryLogicalPath)
+	if err != nil {
+		return err
+	}
+	m.PrimaryClusterId = node.Name
+	return nil
+}
+
+func (m *Task) ReleaseCluster(ring *consistenthashing.ConsistentHashingRing) error {
+	return ring.Release(m.PrimaryClusterId)
+}
+
+// PlaceClusters 副本同步、孤本数据迁移时使用，主操作集群和配合集群一定落在不同的物理节点上
+func (m *Task) PlaceClusters(ring *consistenthashing.ConsistentHashingRing) error {
+	if m.PrimaryLogicalPath == "" {
+		return errors.New("primary_logical_path cannot be empty")
+	}
+	nodes, err := ring.LocateN(m.PrimaryLogicalPath, 2)
+	if err != nil {
+		return err
+	}
+	m.PrimaryClusterId = nodes[0].Name
+	m.SecondaryClusterId = nodes[1].Name
+	return nil
+}
+
+// ApplyMove 环成员变化后，如果主操作逻辑路径落在迁移区间内，把任务设置为从From集群读、写到To集群，返回是否需要迁移
+func (m *Task) ApplyMove(ring *consistenthashing.ConsistentHashingRing, moves []consistenthashing.Move) bool {
+	h := ring.KeyHash(m.PrimaryLogicalPath)
+	for _, move := range moves {
+		if move.Contains(h) {
+			m.PrimaryClusterId = move.To
+			m.SecondaryClusterId = move.From
+			if m.SecondaryLogicalPath == "" {
+				m.SecondaryLogicalPath = m.PrimaryLogicalPath
+			}
+			return true
+		}
+	}
+	return false
+}
+
 func (m *Task) Insert() error {
 	if m.CreateTime.IsZero() {
 		m.CreateTime = time.Now()
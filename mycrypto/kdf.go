@@ -0,0 +1,78 @@
+package mycrypto
+
+import (
+	"crypto/sha256"
+	"errors"
+	"fmt"
+
+	"golang.org/x/crypto/pbkdf2"
+	"golang.org/x/crypto/scrypt"
+)
+
+const (
+	KDFPBKDF2SHA256 byte = 1 //参数：迭代次数
+	KDFScrypt       byte = 2 //参数：log2(N), r, p
+
+	maxScryptLogN   = 22        //N最大4M
+	maxScryptRP     = 1 << 16   //r*p上限
+	maxScryptMem    = 256 << 20 //128*r*N*p的上限，参数来自header，还没有校验任何数据，防止恶意header耗尽内存
+	maxPBKDF2Rounds = 1 << 22   //约4M次，1秒左右
+)
+
+var ErrBadKDF = errors.New("bad kdf params")
+
+// KDF 口令派生密钥的算法和参数，和salt一起保存在header中，解密时按header中的参数派生
+type KDF struct {
+	ID     byte
+	Params []uint32
+}
+
+// DefaultKDF scrypt N=32768 r=8 p=1，约32M内存
+func DefaultKDF() KDF {
+	return KDF{ID: KDFScrypt, Params: []uint32{15, 8, 1}}
+}
+
+// PBKDF2 迭代次数为rounds的PBKDF2-HMAC-SHA256
+func PBKDF2(rounds uint32) KDF {
+	return KDF{ID: KDFPBKDF2SHA256, Params: []uint32{rounds}}
+}
+
+// Scrypt N=1<<logN
+func Scrypt(logN, r, p uint32) KDF {
+	return KDF{ID: KDFScrypt, Params: []uint32{logN, r, p}}
+}
+
+// Validate 检查参数是否合法，参数来自header时防止过大的代价
+func (k KDF) Validate() error {
+	switch k.ID {
+	case KDFPBKDF2SHA256:
+		if len(k.Params) != 1 || k.Params[0] == 0 || k.Params[0] > maxPBKDF2Rounds {
+			return fmt.Errorf("pbkdf2 params %v: %w", k.Params, ErrBadKDF)
+		}
+	case KDFScrypt:
+		if len(k.Params) != 3 || k.Params[0] == 0 || k.Params[0] > maxScryptLogN ||
+			k.Params[1] == 0 || k.Params[2] == 0 || uint64(k.Params[1])*uint64(k.Params[2]) > maxScryptRP {
+			return fmt.Errorf("scrypt params %v: %w", k.Params, ErrBadKDF)
+		}
+		//前面已经限制了logN和r*p，这里不会溢出
+		if 128*uint64(k.Params[1])*uint64(k.Params[2])<<k.Params[0] > maxScryptMem {
+			return fmt.Errorf("scrypt params %v need too much memory: %w", k.Params, ErrBadKDF)
+		}
+	default:
+		return fmt.Errorf("kdf %d not support: %w", k.ID, ErrBadKDF)
+	}
+	return nil
+}
+
+// DeriveKey 从任意长度的口令派生keyLen字节的密钥
+func (k KDF) DeriveKey(password, salt []byte, keyLen int) ([]byte, error) {
+	if err := k.Validate(); err != nil {
+		return nil, err
+	}
+	switch k.ID {
+	case KDFPBKDF2SHA256:
+		return pbkdf2.Key(password, salt, int(k.Params[0]), keyLen, sha256.New), nil
+	default:
+		return scrypt.Key(password, salt, 1<<k.Params[0], int(k.Params[1]), int(k.Params[2]), keyLen)
+	}
+}
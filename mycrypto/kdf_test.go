@@ -0,0 +1,85 @@
+package mycrypto_test
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"io"
+	"test/mycrypto"
+	"testing"
+)
+
+func TestDeriveKey(t *testing.T) {
+	salt := []byte("0123456789abcdef")
+	for _, kdf := range []mycrypto.KDF{mycrypto.DefaultKDF(), mycrypto.PBKDF2(1000), mycrypto.Scrypt(10, 8, 1)} {
+		//任意长度的口令都可以派生出需要长度的密钥
+		for _, password := range []string{"", "a", "a much longer passphrase than any aes key size"} {
+			key, err := kdf.DeriveKey([]byte(password), salt, mycrypto.AES192)
+			if err != nil || len(key) != mycrypto.AES192 {
+				t.Fatalf("kdf %d derive %q get %d bytes, %v", kdf.ID, password, len(key), err)
+			}
+			again, _ := kdf.DeriveKey([]byte(password), salt, mycrypto.AES192)
+			other, _ := kdf.DeriveKey([]byte(password), []byte("fedcba9876543210"), mycrypto.AES192)
+			if !bytes.Equal(key, again) || bytes.Equal(key, other) {
+				t.Fatalf("kdf %d not deterministic or ignore salt", kdf.ID)
+			}
+		}
+	}
+
+	for _, kdf := range []mycrypto.KDF{
+		mycrypto.Scrypt(40, 8, 1),
+		mycrypto.Scrypt(15, 1<<16, 2),
+		mycrypto.Scrypt(22, 1<<16, 1),
+		mycrypto.Scrypt(22, 8, 1),
+		mycrypto.Scrypt(15, 8, 1024),
+		mycrypto.PBKDF2(0),
+		mycrypto.PBKDF2(1 << 26),
+		{ID: 9},
+	} {
+		if _, err := kdf.DeriveKey([]byte("a"), salt, 16); !errors.Is(err, mycrypto.ErrBadKDF) {
+			t.Fatalf("kdf %d %v want ErrBadKDF but get %v", kdf.ID, kdf.Params, err)
+		}
+	}
+}
+
+func TestKDFInHeader(t *testing.T) {
+	buf := &bytes.Buffer{}
+	w, err := mycrypto.NewEncryptWriterKDF(buf, mycrypto.AES256, []byte("pass"), mycrypto.PBKDF2(1000))
+	if err != nil {
+		t.Fatalf("new encrypt writer failed with %v", err)
+	}
+	w.Write([]byte("hello"))
+	w.Close()
+
+	r, err := mycrypto.NewDecryptReader(bytes.NewReader(buf.Bytes()), []byte("pass"))
+	if err != nil {
+		t.Fatalf("new decrypt reader failed with %v", err)
+	}
+	if data, err := io.ReadAll(r); err != nil || string(data) != "hello" {
+		t.Fatalf("decrypt get %q, %v", data, err)
+	}
+
+	//header里的kdf参数被改成很大的代价时直接拒绝
+	data := buf.Bytes()
+	data[len(mycrypto.Magic)+4] = 0xff //第一个参数的最高字节
+	if _, err := mycrypto.NewDecryptReader(bytes.NewReader(data), []byte("pass")); !errors.Is(err, mycrypto.ErrBadHeader) {
+		t.Fatalf("huge kdf params want ErrBadHeader but get %v", err)
+	}
+
+	//每个参数单独都在上限内，但合起来需要32T内存
+	buf.Reset()
+	w, err = mycrypto.NewEncryptWriterKDF(buf, mycrypto.AES256, []byte("pass"), mycrypto.Scrypt(10, 8, 1))
+	if err != nil {
+		t.Fatalf("new encrypt writer failed with %v", err)
+	}
+	w.Write([]byte("hello"))
+	w.Close()
+	data = buf.Bytes()
+	params := data[len(mycrypto.Magic)+4:]
+	binary.BigEndian.PutUint32(params[0:], 22)
+	binary.BigEndian.PutUint32(params[4:], 1<<16)
+	binary.BigEndian.PutUint32(params[8:], 1)
+	if _, err := mycrypto.NewDecryptReader(bytes.NewReader(data), []byte("pass")); !errors.Is(err, mycrypto.ErrBadHeader) {
+		t.Fatalf("scrypt {22, 1<<16, 1} want ErrBadHeader but get %v", err)
+	}
+}
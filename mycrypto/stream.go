@@ -0,0 +1,328 @@
+package mycrypto
+
+import (
+	"bytes"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+)
+
+/*
+加密格式（version 1），mygzip、myzip和Encrypt共用：
+header: magic(4) | version(1) | encryptType(1) | kdf(1) | kdf参数个数(1) | kdf参数(每个4字节大端) | salt长度(1) | salt | nonce前缀(7) | chunkSize(4字节大端)
+kdf见KDF，口令可以是任意长度。
+之后是若干帧，每帧为一个chunk的AES-GCM密文加16字节tag，最后一帧的明文小于等于chunkSize，可以为空。
+第i帧的nonce为 nonce前缀(7) | i(4字节大端) | 是否最后一帧(1)，整个header作为每一帧的附加数据（STREAM结构），
+帧被修改、重排、截断或者header被修改都会校验失败
+*/
+
+const (
+	Magic         = "MGZE"
+	formatVersion = 1
+
+	AES128 = 16
+	AES192 = 24
+	AES256 = 32
+
+	DefaultChunkSize = 64 * 1024
+
+	saltSize        = 16
+	noncePrefixSize = 7
+	tagSize         = 16
+	maxChunkSize    = 16 * 1024 * 1024
+)
+
+var (
+	ErrBadHeader  = errors.New("bad encrypted archive header")
+	ErrAuthFailed = errors.New("message authentication failed")
+	ErrTruncated  = errors.New("encrypted archive truncated")
+)
+
+type header struct {
+	encryptType int
+	kdf         KDF
+	salt        []byte
+	noncePrefix []byte
+	chunkSize   uint32
+	raw         []byte //编码后的header，作为附加数据
+}
+
+func (h *header) marshal() []byte {
+	buf := bytes.NewBufferString(Magic)
+	buf.WriteByte(formatVersion)
+	buf.WriteByte(byte(h.encryptType))
+	buf.WriteByte(h.kdf.ID)
+	buf.WriteByte(byte(len(h.kdf.Params)))
+	for _, p := range h.kdf.Params {
+		binary.Write(buf, binary.BigEndian, p)
+	}
+	buf.WriteByte(byte(len(h.salt)))
+	buf.Write(h.salt)
+	buf.Write(h.noncePrefix)
+	binary.Write(buf, binary.BigEndian, h.chunkSize)
+	return buf.Bytes()
+}
+
+// readHeader 调用者已经读取并校验了magic
+func readHeader(r io.Reader) (*header, error) {
+	raw := bytes.NewBufferString(Magic)
+	tr := io.TeeReader(r, raw)
+	fixed := make([]byte, 4)
+	if _, err := io.ReadFull(tr, fixed); err != nil {
+		return nil, fmt.Errorf("read header failed with %v: %w", err, ErrBadHeader)
+	}
+	if fixed[0] != formatVersion {
+		return nil, fmt.Errorf("version %d not support: %w", fixed[0], ErrBadHeader)
+	}
+	h := &header{encryptType: int(fixed[1]), kdf: KDF{ID: fixed[2], Params: make([]uint32, fixed[3])}}
+	if h.encryptType != AES128 && h.encryptType != AES192 && h.encryptType != AES256 {
+		return nil, fmt.Errorf("encryptType %d not support: %w", h.encryptType, ErrBadHeader)
+	}
+	if err := binary.Read(tr, binary.BigEndian, h.kdf.Params); err != nil {
+		return nil, fmt.Errorf("read kdf params failed with %v: %w", err, ErrBadHeader)
+	}
+	if err := h.kdf.Validate(); err != nil {
+		return nil, fmt.Errorf("%v: %w", err, ErrBadHeader)
+	}
+	saltLen := make([]byte, 1)
+	if _, err := io.ReadFull(tr, saltLen); err != nil {
+		return nil, fmt.Errorf("read salt failed with %v: %w", err, ErrBadHeader)
+	}
+	h.salt = make([]byte, saltLen[0])
+	h.noncePrefix = make([]byte, noncePrefixSize)
+	if _, err := io.ReadFull(tr, h.salt); err != nil {
+		return nil, fmt.Errorf("read salt failed with %v: %w", err, ErrBadHeader)
+	}
+	if _, err := io.ReadFull(tr, h.noncePrefix); err != nil {
+		return nil, fmt.Errorf("read nonce failed with %v: %w", err, ErrBadHeader)
+	}
+	if err := binary.Read(tr, binary.BigEndian, &h.chunkSize); err != nil {
+		return nil, fmt.Errorf("read chunk size failed with %v: %w", err, ErrBadHeader)
+	}
+	if h.chunkSize == 0 || h.chunkSize > maxChunkSize {
+		return nil, fmt.Errorf("chunk size %d: %w", h.chunkSize, ErrBadHeader)
+	}
+	h.raw = raw.Bytes()
+	return h, nil
+}
+
+// aead 根据header里的kdf参数从用户的口令派生加密key
+func (h *header) aead(key []byte) (cipher.AEAD, error) {
+	dk, err := h.kdf.DeriveKey(key, h.salt, h.encryptType)
+	if err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(dk)
+	if err != nil {
+		return nil, err
+	}
+	return cipher.NewGCM(block)
+}
+
+func (h *header) nonce(counter uint32, last bool) []byte {
+	nonce := make([]byte, noncePrefixSize+5)
+	copy(nonce, h.noncePrefix)
+	binary.BigEndian.PutUint32(nonce[noncePrefixSize:], counter)
+	if last {
+		nonce[noncePrefixSize+4] = 1
+	}
+	return nonce
+}
+
+type encryptWriter struct {
+	w       io.Writer
+	h       *header
+	aead    cipher.AEAD
+	buf     []byte
+	counter uint32
+	closed  bool
+}
+
+// NewEncryptWriter 使用DefaultKDF，见NewEncryptWriterKDF
+func NewEncryptWriter(w io.Writer, encryptType int, key []byte) (io.WriteCloser, error) {
+	return NewEncryptWriterKDF(w, encryptType, key, DefaultKDF())
+}
+
+// NewEncryptWriterKDF 返回加密的Writer，写入的数据按chunk加密，必须调用Close写入最后一帧。
+// salt和nonce前缀每次随机生成，同一个key加密的不同文件不会共用密钥流
+func NewEncryptWriterKDF(w io.Writer, encryptType int, key []byte, kdf KDF) (io.WriteCloser, error) {
+	if encryptType != AES128 && encryptType != AES192 && encryptType != AES256 {
+		return nil, fmt.Errorf("encryptType not support(support AES128,AES192,AES256)")
+	}
+	if err := kdf.Validate(); err != nil {
+		return nil, err
+	}
+	h := &header{
+		encryptType: encryptType,
+		kdf:         kdf,
+		salt:        make([]byte, saltSize),
+		noncePrefix: make([]byte, noncePrefixSize),
+		chunkSize:   DefaultChunkSize,
+	}
+	if _, err := io.ReadFull(rand.Reader, h.salt); err != nil {
+		return nil, err
+	}
+	if _, err := io.ReadFull(rand.Reader, h.noncePrefix); err != nil {
+		return nil, err
+	}
+	h.raw = h.marshal()
+	aead, err := h.aead(key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := w.Write(h.raw); err != nil {
+		return nil, err
+	}
+	return &encryptWriter{w: w, h: h, aead: aead, buf: make([]byte, 0, h.chunkSize)}, nil
+}
+
+func (ew *encryptWriter) Write(p []byte) (int, error) {
+	if ew.closed {
+		return 0, errors.New("write to closed encrypt writer")
+	}
+	n := 0
+	for len(p) > 0 {
+		//chunk写满并且还有数据时才加密，保证最后一帧在Close时写入
+		if len(ew.buf) == cap(ew.buf) {
+			if err := ew.flush(false); err != nil {
+				return n, err
+			}
+		}
+		m := copy(ew.buf[len(ew.buf):cap(ew.buf)], p)
+		ew.buf = ew.buf[:len(ew.buf)+m]
+		p = p[m:]
+		n += m
+	}
+	return n, nil
+}
+
+func (ew *encryptWriter) flush(last bool) error {
+	if ew.counter == ^uint32(0) {
+		return errors.New("too many chunks")
+	}
+	frame := ew.aead.Seal(nil, ew.h.nonce(ew.counter, last), ew.buf, ew.h.raw)
+	ew.counter++
+	ew.buf = ew.buf[:0]
+	_, err := ew.w.Write(frame)
+	return err
+}
+
+// Close 写入最后一帧，不会关闭下层的Writer
+func (ew *encryptWriter) Close() error {
+	if ew.closed {
+		return nil
+	}
+	ew.closed = true
+	return ew.flush(true)
+}
+
+type decryptReader struct {
+	r       io.Reader
+	h       *header
+	aead    cipher.AEAD
+	frame   []byte
+	out     []byte //解密的输出，校验失败时Open会清空输出，不能和frame共用
+	next    []byte //预读的下一帧的第一个字节
+	plain   []byte
+	counter uint32
+	done    bool
+}
+
+// NewDecryptReader 读取header并返回解密的Reader，每一帧校验通过后才会返回数据，
+// 校验失败返回ErrAuthFailed，最后一帧之前结束返回ErrTruncated
+func NewDecryptReader(r io.Reader, key []byte) (io.Reader, error) {
+	m := make([]byte, len(Magic))
+	if _, err := io.ReadFull(r, m); err != nil || string(m) != Magic {
+		return nil, fmt.Errorf("bad magic: %w", ErrBadHeader)
+	}
+	return newDecryptReader(r, key)
+}
+
+// NewReader 根据magic判断格式，是加密格式时返回解密的Reader，否则交给legacy处理旧格式。
+// 旧格式没有校验，legacy为nil时不接受，返回ErrBadHeader
+func NewReader(r io.Reader, key []byte, legacy func(r io.Reader) (io.Reader, error)) (io.Reader, error) {
+	m := make([]byte, len(Magic))
+	n, err := io.ReadFull(r, m)
+	if err == nil && string(m) == Magic {
+		return newDecryptReader(r, key)
+	}
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return nil, err
+	}
+	if legacy == nil {
+		return nil, fmt.Errorf("bad magic: %w", ErrBadHeader)
+	}
+	return legacy(io.MultiReader(bytes.NewReader(m[:n]), r))
+}
+
+func newDecryptReader(r io.Reader, key []byte) (*decryptReader, error) {
+	h, err := readHeader(r)
+	if err != nil {
+		return nil, err
+	}
+	aead, err := h.aead(key)
+	if err != nil {
+		return nil, err
+	}
+	return &decryptReader{r: r, h: h, aead: aead, frame: make([]byte, int(h.chunkSize)+tagSize), out: make([]byte, 0, h.chunkSize)}, nil
+}
+
+func (dr *decryptReader) Read(p []byte) (int, error) {
+	for len(dr.plain) == 0 {
+		if dr.done {
+			return 0, io.EOF
+		}
+		if err := dr.readFrame(); err != nil {
+			return 0, err
+		}
+	}
+	n := copy(p, dr.plain)
+	dr.plain = dr.plain[n:]
+	return n, nil
+}
+
+// readFrame 读取并校验一帧，读满一帧后再预读一个字节判断是否为最后一帧
+func (dr *decryptReader) readFrame() error {
+	n := copy(dr.frame, dr.next)
+	dr.next = nil
+	m, err := io.ReadFull(dr.r, dr.frame[n:])
+	n += m
+	last := false
+	switch err {
+	case nil:
+		one := make([]byte, 1)
+		if _, err := io.ReadFull(dr.r, one); err == io.EOF {
+			last = true
+		} else if err != nil {
+			return err
+		} else {
+			dr.next = one
+		}
+	case io.EOF, io.ErrUnexpectedEOF:
+		last = true
+	default:
+		return err
+	}
+	if n < tagSize {
+		return ErrTruncated
+	}
+
+	plain, err := dr.aead.Open(dr.out[:0], dr.h.nonce(dr.counter, last), dr.frame[:n], dr.h.raw)
+	if err != nil {
+		if last {
+			//截断在帧边界时，最后读到的帧是按非最后一帧加密的
+			if _, err := dr.aead.Open(nil, dr.h.nonce(dr.counter, false), dr.frame[:n], dr.h.raw); err == nil {
+				return ErrTruncated
+			}
+		}
+		return fmt.Errorf("chunk %d: %w", dr.counter, ErrAuthFailed)
+	}
+	dr.counter++
+	dr.plain = plain
+	dr.done = last
+	return nil
+}
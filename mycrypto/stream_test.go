@@ -0,0 +1,60 @@
+package mycrypto_test
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"test/mycrypto"
+	"testing"
+)
+
+func TestTamper(t *testing.T) {
+	key := []byte("secret")
+	plain := bytes.Repeat([]byte("abcdefgh"), mycrypto.DefaultChunkSize/4) //两个chunk
+	buf := &bytes.Buffer{}
+	w, err := mycrypto.NewEncryptWriter(buf, mycrypto.AES128, key)
+	if err != nil {
+		t.Fatalf("new encrypt writer failed with %v", err)
+	}
+	if _, err := w.Write(plain); err != nil {
+		t.Fatalf("write failed with %v", err)
+	}
+	if err := w.Close(); err != nil {
+		t.Fatalf("close failed with %v", err)
+	}
+	data := buf.Bytes()
+
+	read := func(data []byte) ([]byte, error) {
+		r, err := mycrypto.NewDecryptReader(bytes.NewReader(data), key)
+		if err != nil {
+			return nil, err
+		}
+		return io.ReadAll(r)
+	}
+	if got, err := read(data); err != nil || !bytes.Equal(got, plain) {
+		t.Fatalf("decrypt get %d bytes, %v", len(got), err)
+	}
+
+	//修改帧
+	tampered := append([]byte(nil), data...)
+	tampered[len(tampered)-mycrypto.DefaultChunkSize*2] ^= 1
+	if _, err := read(tampered); !errors.Is(err, mycrypto.ErrAuthFailed) {
+		t.Fatalf("tampered frame want ErrAuthFailed but get %v", err)
+	}
+	//修改header
+	tampered = append([]byte(nil), data...)
+	tampered[20] ^= 1
+	if _, err := read(tampered); err == nil {
+		t.Fatalf("tampered header want err but not")
+	}
+
+	//在帧边界截断，少了最后一帧。明文正好两个chunk，最后一帧也是满的
+	frame := mycrypto.DefaultChunkSize + 16
+	headerSize := len(data) - 2*frame
+	if _, err := read(data[:headerSize+frame]); !errors.Is(err, mycrypto.ErrTruncated) {
+		t.Fatalf("truncated archive want ErrTruncated but get %v", err)
+	}
+	if _, err := read(data[:len(data)-1]); err == nil {
+		t.Fatalf("truncated frame want err but not")
+	}
+}
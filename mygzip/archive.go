@@ -0,0 +1,230 @@
+package mygzip
+
+import (
+	"archive/tar"
+	"compress/gzip"
+	"fmt"
+	"io"
+	"io/fs"
+	"test/mycrypto"
+	"time"
+)
+
+type archiveConfig struct {
+	compressLevel int
+	encryptType   int
+	key           []byte
+	kdf           mycrypto.KDF
+	preserve      Preserve
+	legacy        bool
+}
+
+type Option func(*archiveConfig)
+
+// WithCompressLevel 设置压缩级别，默认DefaultCompression，只对ArchiveWriter有效
+func WithCompressLevel(level int) Option {
+	return func(c *archiveConfig) {
+		c.compressLevel = level
+	}
+}
+
+// WithEncryption 使用key加密或者解密，key可以是任意长度的口令。
+// 写入时使用mycrypto的格式；读取时只接受mycrypto的格式，encryptType只用于WithLegacyFormat时的旧格式
+func WithEncryption(encryptType int, key []byte) Option {
+	return func(c *archiveConfig) {
+		c.encryptType = encryptType
+		c.key = key
+	}
+}
+
+// WithLegacyFormat 读取时也接受旧格式（AES-OFB，没有校验）加密的归档，只对ArchiveReader有效。
+// 旧格式可以被篡改而不被发现，只在迁移可信来源的旧归档时使用
+func WithLegacyFormat() Option {
+	return func(c *archiveConfig) {
+		c.legacy = true
+	}
+}
+
+// WithKDF 设置加密时口令派生密钥的算法，默认mycrypto.DefaultKDF()
+func WithKDF(kdf mycrypto.KDF) Option {
+	return func(c *archiveConfig) {
+		c.kdf = kdf
+	}
+}
+
+func newArchiveConfig(opts []Option) *archiveConfig {
+	c := &archiveConfig{compressLevel: DefaultCompression, encryptType: AES256, kdf: mycrypto.DefaultKDF(), preserve: DefaultPreserve}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// ArchiveWriter 把条目写成tar.gz流，可以直接写到S3上传或者HTTP响应，不需要临时文件
+type ArchiveWriter struct {
+	tw            *tar.Writer
+	gw            *gzip.Writer
+	encryptWriter io.WriteCloser
+	preserve      Preserve
+}
+
+// NewArchiveWriter 写入完成后需要调用Close，Close不会关闭w
+func NewArchiveWriter(w io.Writer, opts ...Option) (*ArchiveWriter, error) {
+	c := newArchiveConfig(opts)
+	aw := &ArchiveWriter{preserve: c.preserve}
+	if c.key != nil {
+		encryptWriter, err := mycrypto.NewEncryptWriterKDF(w, c.encryptType, c.key, c.kdf)
+		if err != nil {
+			return nil, err
+		}
+		aw.encryptWriter = encryptWriter
+		w = encryptWriter
+	}
+	gw, err := gzip.NewWriterLevel(w, c.compressLevel)
+	if err != nil {
+		return nil, err
+	}
+	aw.gw = gw
+	aw.tw = tar.NewWriter(gw)
+	return aw, nil
+}
+
+// Add 写入一个条目，普通文件从r读取header.Size字节，其他类型r可以为nil
+func (aw *ArchiveWriter) Add(header *tar.Header, r io.Reader) error {
+	if err := aw.tw.WriteHeader(header); err != nil {
+		return err
+	}
+	if header.Typeflag != tar.TypeReg || r == nil {
+		return nil
+	}
+	n, err := io.Copy(aw.tw, r)
+	if err != nil {
+		return err
+	}
+	if n != header.Size {
+		return fmt.Errorf("%s want %d bytes but get %d", header.Name, header.Size, n)
+	}
+	return nil
+}
+
+// AddReader 把r中的size字节写成名为name的普通文件，权限0644，修改时间为当前时间
+func (aw *ArchiveWriter) AddReader(name string, r io.Reader, size int64) error {
+	return aw.Add(&tar.Header{
+		Typeflag: tar.TypeReg,
+		Name:     name,
+		Size:     size,
+		Mode:     0644,
+		ModTime:  time.Now(),
+	}, r)
+}
+
+// AddFS 写入fsys中root下的所有目录和普通文件，条目名为在fsys中的路径，其他类型的文件跳过
+func (aw *ArchiveWriter) AddFS(fsys fs.FS, root string) error {
+	return fs.WalkDir(fsys, root, func(name string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !d.IsDir() && !d.Type().IsRegular() {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			return err
+		}
+		header, err := tar.FileInfoHeader(info, "")
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if d.IsDir() {
+			header.Name += "/"
+			return aw.Add(header, nil)
+		}
+
+		f, err := fsys.Open(name)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return aw.Add(header, f)
+	})
+}
+
+// Close 依次关闭tar、gzip和加密流，加密时最后一帧在这里写入
+func (aw *ArchiveWriter) Close() error {
+	if err := aw.tw.Close(); err != nil {
+		return err
+	}
+	if err := aw.gw.Close(); err != nil {
+		return err
+	}
+	if aw.encryptWriter != nil {
+		return aw.encryptWriter.Close()
+	}
+	return nil
+}
+
+// ArchiveReader 逐个读取tar.gz流中的条目，用法和tar.Reader相同
+type ArchiveReader struct {
+	tr       *tar.Reader
+	zr       *gzip.Reader
+	cr       *countingReader //统计读取的归档字节数，用于检查压缩比
+	preserve Preserve
+}
+
+// NewArchiveReader 使用WithEncryption时每一帧校验通过后才会返回数据，不是mycrypto的格式时返回mycrypto.ErrBadHeader，
+// 同时使用WithLegacyFormat时按旧格式读取
+func NewArchiveReader(r io.Reader, opts ...Option) (*ArchiveReader, error) {
+	c := newArchiveConfig(opts)
+	cr := &countingReader{r: r}
+	r = cr
+	if c.key != nil {
+		var legacy func(r io.Reader) (io.Reader, error)
+		if c.legacy {
+			legacy = func(r io.Reader) (io.Reader, error) {
+				return NewLegacyReader(r, c.encryptType, c.key)
+			}
+		}
+		var err error
+		r, err = mycrypto.NewReader(r, c.key, legacy)
+		if err != nil {
+			return nil, err
+		}
+	}
+	zr, err := gzip.NewReader(r)
+	if err != nil {
+		return nil, err
+	}
+	return &ArchiveReader{tr: tar.NewReader(zr), zr: zr, cr: cr, preserve: c.preserve}, nil
+}
+
+// Next 移动到下一个条目，没有条目时返回io.EOF
+func (ar *ArchiveReader) Next() (*tar.Header, error) {
+	return ar.tr.Next()
+}
+
+// Read 读取当前条目的内容
+func (ar *ArchiveReader) Read(p []byte) (int, error) {
+	return ar.tr.Read(p)
+}
+
+// Close 不会关闭NewArchiveReader传入的r
+func (ar *ArchiveReader) Close() error {
+	return ar.zr.Close()
+}
+
+// compressed 返回目前读取的归档字节数
+func (ar *ArchiveReader) compressed() int64 {
+	return ar.cr.n
+}
+
+type countingReader struct {
+	r io.Reader
+	n int64
+}
+
+func (cr *countingReader) Read(p []byte) (int, error) {
+	n, err := cr.r.Read(p)
+	cr.n += int64(n)
+	return n, err
+}
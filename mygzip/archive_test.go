@@ -0,0 +1,81 @@
+package mygzip_test
+
+import (
+	"bytes"
+	"io"
+	"strings"
+	"test/mygzip"
+	"testing"
+	"testing/fstest"
+)
+
+func TestArchiveStream(t *testing.T) {
+	fsys := fstest.MapFS{
+		"data/a.txt":     {Data: []byte("hello"), Mode: 0644},
+		"data/sub/b.txt": {Data: []byte("world"), Mode: 0600},
+	}
+	for _, opts := range [][]mygzip.Option{
+		nil,
+		{mygzip.WithCompressLevel(mygzip.BestSpeed), mygzip.WithEncryption(mygzip.AES128, []byte("pass"))},
+	} {
+		buf := &bytes.Buffer{}
+		aw, err := mygzip.NewArchiveWriter(buf, opts...)
+		if err != nil {
+			t.Fatalf("new archive writer failed with %v", err)
+		}
+		if err := aw.AddFS(fsys, "data"); err != nil {
+			t.Fatalf("add fs failed with %v", err)
+		}
+		if err := aw.AddReader("stream.log", strings.NewReader("from reader"), 11); err != nil {
+			t.Fatalf("add reader failed with %v", err)
+		}
+		if err := aw.Close(); err != nil {
+			t.Fatalf("close failed with %v", err)
+		}
+
+		ar, err := mygzip.NewArchiveReader(bytes.NewReader(buf.Bytes()), opts...)
+		if err != nil {
+			t.Fatalf("new archive reader failed with %v", err)
+		}
+		got := make(map[string]string)
+		for {
+			header, err := ar.Next()
+			if err == io.EOF {
+				break
+			}
+			if err != nil {
+				t.Fatalf("next failed with %v", err)
+			}
+			data, err := io.ReadAll(ar)
+			if err != nil {
+				t.Fatalf("read %s failed with %v", header.Name, err)
+			}
+			got[header.Name] = string(data)
+		}
+		ar.Close()
+
+		want := map[string]string{
+			"data/":          "",
+			"data/a.txt":     "hello",
+			"data/sub/":      "",
+			"data/sub/b.txt": "world",
+			"stream.log":     "from reader",
+		}
+		if len(got) != len(want) {
+			t.Fatalf("want %v but get %v", want, got)
+		}
+		for name, content := range want {
+			if got[name] != content {
+				t.Fatalf("%s want %q but get %q", name, content, got[name])
+			}
+		}
+	}
+
+	aw, err := mygzip.NewArchiveWriter(io.Discard)
+	if err != nil {
+		t.Fatalf("new archive writer failed with %v", err)
+	}
+	if err := aw.AddReader("short.log", strings.NewReader("abc"), 10); err == nil {
+		t.Fatalf("add reader with wrong size want err but not")
+	}
+}
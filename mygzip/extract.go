@@ -0,0 +1,418 @@
+package mygzip
+
+import (
+	"archive/tar"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// PathMode 条目路径跳出解压目录（绝对路径或者../）时的处理方式
+type PathMode int
+
+const (
+	RejectEscaping   PathMode = iota //默认，返回ErrPathEscape
+	SanitizeEscaping                 //去掉开头的/和../，放到解压目录内
+)
+
+// LinkMode 符号链接和硬链接的处理方式
+type LinkMode int
+
+const (
+	SkipLinks   LinkMode = iota //默认，跳过
+	RejectLinks                 //返回ErrLinkNotAllowed
+	AllowLinks                  //创建链接，链接目标必须在解压目录内，否则返回ErrLinkEscape
+)
+
+var (
+	ErrPathEscape     = errors.New("path escapes destination")
+	ErrLinkNotAllowed = errors.New("link not allowed")
+	ErrLinkEscape     = errors.New("link target escapes destination")
+	ErrTooLarge       = errors.New("archive too large")
+	ErrTooManyEntries = errors.New("too many entries")
+	ErrRatioExceeded  = errors.New("compression ratio exceeded")
+)
+
+// ExtractError 解压某个条目时违反了ExtractPolicy，Err为上面的错误之一
+type ExtractError struct {
+	Name string
+	Err  error
+}
+
+func (e *ExtractError) Error() string {
+	return fmt.Sprintf("extract %s: %v", e.Name, e.Err)
+}
+
+func (e *ExtractError) Unwrap() error {
+	return e.Err
+}
+
+// ratioMinBytes 解压后的数据超过这个大小才检查压缩比，小文件的压缩比本身可能很高
+const ratioMinBytes = 1 << 20
+
+// ExtractPolicy 解压用户上传的归档时的限制，零值为拒绝跳出的路径、跳过链接、不限制大小
+type ExtractPolicy struct {
+	Paths      PathMode
+	Symlinks   LinkMode
+	Hardlinks  LinkMode
+	MaxBytes   int64   //解压后普通文件的总字节数，0表示不限制
+	MaxEntries int     //条目数，0表示不限制
+	MaxRatio   float64 //解压后字节数和读取的归档字节数之比，0表示不限制
+}
+
+// DefaultExtractPolicy UnGzip使用的策略：拒绝跳出的路径，只允许指向解压目录内的链接，最多10G、100万个条目、压缩比100
+func DefaultExtractPolicy() ExtractPolicy {
+	return ExtractPolicy{
+		Symlinks:   AllowLinks,
+		Hardlinks:  AllowLinks,
+		MaxBytes:   10 << 30,
+		MaxEntries: 1000000,
+		MaxRatio:   100,
+	}
+}
+
+// resolve 返回条目在解压目录内的相对路径（/分隔），"."表示解压目录本身
+func (p ExtractPolicy) resolve(name string) (string, error) {
+	clean := path.Clean(strings.ReplaceAll(name, `\`, "/"))
+	if !path.IsAbs(clean) && clean != ".." && !strings.HasPrefix(clean, "../") {
+		return clean, nil
+	}
+	if p.Paths != SanitizeEscaping {
+		return "", &ExtractError{Name: name, Err: ErrPathEscape}
+	}
+	clean = strings.TrimPrefix(path.Clean("/"+clean), "/")
+	if clean == "" {
+		clean = "."
+	}
+	return clean, nil
+}
+
+type extractor struct {
+	policy  ExtractPolicy
+	dst     string
+	root    string //dst的真实绝对路径
+	ar      *ArchiveReader
+	written int64
+	entries int
+}
+
+// Extract 按policy把剩下的所有条目解压到dst目录，按WithPreserve设置元数据，目录的权限和修改时间在最后设置
+func (ar *ArchiveReader) Extract(dst string, policy ExtractPolicy) error {
+	if err := os.MkdirAll(dst, os.ModePerm); err != nil {
+		return err
+	}
+	root, err := filepath.Abs(dst)
+	if err != nil {
+		return err
+	}
+	if root, err = filepath.EvalSymlinks(root); err != nil {
+		return err
+	}
+	e := &extractor{policy: policy, dst: dst, root: root, ar: ar}
+
+	dirHeaderList := make([]*tar.Header, 0, 128)
+	for {
+		header, err := ar.Next()
+		if err == io.EOF {
+			break // End of archive
+		}
+		if err != nil {
+			return err
+		}
+
+		e.entries++
+		if policy.MaxEntries > 0 && e.entries > policy.MaxEntries {
+			return &ExtractError{Name: header.Name, Err: ErrTooManyEntries}
+		}
+		rel, err := policy.resolve(header.Name)
+		if err != nil {
+			return err
+		}
+		target := filepath.Join(dst, filepath.FromSlash(rel))
+
+		// check the type
+		switch header.Typeflag {
+		// if its a dir and it doesn't exist create it
+		case tar.TypeDir:
+			//target本身可能是之前创建的链接
+			if err := e.checkPath(target, header.Name); err != nil {
+				return err
+			}
+			if err := os.MkdirAll(target, os.ModePerm); err != nil {
+				return err
+			}
+			header.Name = rel
+			dirHeaderList = append(dirHeaderList, header)
+		// if it's a file create it, sparse files are written with holes filled
+		case tar.TypeReg, tar.TypeGNUSparse:
+			if err := e.file(target, header); err != nil {
+				return err
+			}
+		case tar.TypeSymlink:
+			if err := e.symlink(target, header); err != nil {
+				return err
+			}
+		case tar.TypeLink:
+			if err := e.hardlink(target, header); err != nil {
+				return err
+			}
+		}
+	}
+
+	//倒序设置，子目录先于上级目录，上级目录没有写权限时也不影响
+	for i := len(dirHeaderList) - 1; i >= 0; i-- {
+		header := dirHeaderList[i]
+		target := filepath.Join(dst, filepath.FromSlash(header.Name))
+		if err := e.checkPath(target, header.Name); err != nil {
+			return err
+		}
+		if err := e.applyMeta(target, header); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// ExtractTo 使用DefaultExtractPolicy解压
+func (ar *ArchiveReader) ExtractTo(dst string) error {
+	return ar.Extract(dst, DefaultExtractPolicy())
+}
+
+func (e *extractor) file(target string, header *tar.Header) error {
+	if err := e.checkParent(target, header.Name); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+	//已存在的链接先删除，避免写到链接指向的文件
+	if fi, err := os.Lstat(target); err == nil && fi.Mode()&os.ModeSymlink != 0 {
+		if err := os.Remove(target); err != nil {
+			return err
+		}
+	}
+	fileToWrite, err := os.OpenFile(target, os.O_CREATE|os.O_RDWR|os.O_TRUNC, 0666)
+	if err != nil {
+		return err
+	}
+	// copy over contents
+	if err := e.copy(fileToWrite, header.Name); err != nil {
+		fileToWrite.Close()
+		return err
+	}
+	if err := fileToWrite.Close(); err != nil {
+		return err
+	}
+	return e.applyMeta(target, header)
+}
+
+// copy 边写边检查总大小和压缩比
+func (e *extractor) copy(w io.Writer, name string) error {
+	buf := make([]byte, 32*1024)
+	for {
+		n, err := e.ar.Read(buf)
+		if n > 0 {
+			if err := e.account(int64(n), name); err != nil {
+				return err
+			}
+			if _, err := w.Write(buf[:n]); err != nil {
+				return err
+			}
+		}
+		if err == io.EOF {
+			return nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// account 累加解压的字节数，超过MaxBytes或者MaxRatio时返回错误
+func (e *extractor) account(n int64, name string) error {
+	e.written += n
+	if e.policy.MaxBytes > 0 && e.written > e.policy.MaxBytes {
+		return &ExtractError{Name: name, Err: ErrTooLarge}
+	}
+	if e.policy.MaxRatio > 0 && e.written > ratioMinBytes && float64(e.written) > e.policy.MaxRatio*float64(e.ar.compressed()) {
+		return &ExtractError{Name: name, Err: ErrRatioExceeded}
+	}
+	return nil
+}
+
+// checkParent 目标的上级目录可能是之前创建的链接或者dst中已有的链接，真实路径必须仍在解压目录内
+func (e *extractor) checkParent(target, name string) error {
+	return e.checkPath(filepath.Dir(target), name)
+}
+
+// checkPath p还不存在时检查已存在的最近一级
+func (e *extractor) checkPath(p, name string) error {
+	for {
+		if _, err := os.Lstat(p); err == nil {
+			break
+		}
+		p = filepath.Dir(p)
+	}
+	real, err := filepath.EvalSymlinks(p)
+	if err != nil {
+		return err
+	}
+	if real, err = filepath.Abs(real); err != nil {
+		return err
+	}
+	if !within(e.root, real) {
+		return &ExtractError{Name: name, Err: ErrLinkEscape}
+	}
+	return nil
+}
+
+func (e *extractor) symlink(target string, header *tar.Header) error {
+	switch e.policy.Symlinks {
+	case RejectLinks:
+		return &ExtractError{Name: header.Name, Err: ErrLinkNotAllowed}
+	case AllowLinks:
+	default:
+		return nil
+	}
+	if e.ar.preserve&PreserveSymlinks == 0 {
+		return nil
+	}
+
+	linkname := filepath.FromSlash(header.Linkname)
+	if filepath.IsAbs(linkname) {
+		return &ExtractError{Name: header.Name, Err: ErrLinkEscape}
+	}
+	if err := e.checkParent(target, header.Name); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+	if err := e.checkLinkTarget(target, linkname, header.Name); err != nil {
+		return err
+	}
+	//不替换已存在的文件，否则已经检查过的链接解析的结果可能改变
+	if err := os.Symlink(linkname, target); err != nil {
+		return err
+	}
+	return e.applyMeta(target, header)
+}
+
+// checkLinkTarget 链接目标按链接所在目录的真实路径解析，经过之前创建的链接后也必须在解压目录内。
+// 含有..的目标必须已经存在，否则之后创建的链接可能让..指向解压目录外
+func (e *extractor) checkLinkTarget(target, linkname, name string) error {
+	parent, err := filepath.EvalSymlinks(filepath.Dir(target))
+	if err != nil {
+		return err
+	}
+	if parent, err = filepath.Abs(parent); err != nil {
+		return err
+	}
+	//不能用filepath.Join，它会在解析链接之前按文本去掉..
+	resolved := parent + string(filepath.Separator) + linkname
+	if !hasDotDot(linkname) {
+		return e.checkPath(filepath.Clean(resolved), name)
+	}
+	real, err := filepath.EvalSymlinks(resolved)
+	if err != nil {
+		return &ExtractError{Name: name, Err: ErrLinkEscape}
+	}
+	if real, err = filepath.Abs(real); err != nil {
+		return err
+	}
+	if !within(e.root, real) {
+		return &ExtractError{Name: name, Err: ErrLinkEscape}
+	}
+	return nil
+}
+
+func hasDotDot(p string) bool {
+	for _, elem := range strings.Split(filepath.ToSlash(p), "/") {
+		if elem == ".." {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *extractor) hardlink(target string, header *tar.Header) error {
+	switch e.policy.Hardlinks {
+	case RejectLinks:
+		return &ExtractError{Name: header.Name, Err: ErrLinkNotAllowed}
+	case AllowLinks:
+	default:
+		return nil
+	}
+
+	//硬链接的目标是归档内的路径
+	rel, err := e.policy.resolve(header.Linkname)
+	if err != nil {
+		return &ExtractError{Name: header.Name, Err: ErrLinkEscape}
+	}
+	source := filepath.Join(e.dst, filepath.FromSlash(rel))
+	//源文件只能是解压目录内的普通文件，不能经过链接指到外部
+	if fi, err := os.Lstat(source); err != nil || !fi.Mode().IsRegular() {
+		return &ExtractError{Name: header.Name, Err: ErrLinkNotAllowed}
+	}
+	if err := e.checkPath(source, header.Name); err != nil {
+		return err
+	}
+	if err := e.checkParent(target, header.Name); err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(target), os.ModePerm); err != nil {
+		return err
+	}
+	os.Remove(target)
+	if e.ar.preserve&PreserveHardlinks == 0 {
+		return e.copyFile(source, target, header.Name)
+	}
+	return os.Link(source, target)
+}
+
+// copyFile 不保留硬链接时复制一份，复制的字节数也计入总大小
+func (e *extractor) copyFile(source, target, name string) error {
+	lfi, err := os.Lstat(source)
+	if err != nil {
+		return err
+	}
+	in, err := os.Open(source)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	fi, err := in.Stat()
+	if err != nil {
+		return err
+	}
+	//打开的必须是Lstat看到的普通文件，不能在检查之后被换成链接
+	if !lfi.Mode().IsRegular() || !os.SameFile(lfi, fi) {
+		return &ExtractError{Name: name, Err: ErrLinkNotAllowed}
+	}
+	if err := e.account(fi.Size(), name); err != nil {
+		return err
+	}
+	out, err := os.OpenFile(target, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, fi.Mode().Perm())
+	if err != nil {
+		return err
+	}
+	if _, err := io.Copy(out, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Chtimes(target, fi.ModTime(), fi.ModTime())
+}
+
+// within 判断path是否为root或者在root下
+func within(root, p string) bool {
+	rel, err := filepath.Rel(root, p)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
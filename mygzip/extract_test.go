@@ -0,0 +1,182 @@
+package mygzip_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"test/mygzip"
+	"testing"
+)
+
+// buildArchive 用原始header构造归档，data为nil的是链接或目录
+func buildArchive(t *testing.T, headers []*tar.Header, data []string) []byte {
+	buf := &bytes.Buffer{}
+	aw, err := mygzip.NewArchiveWriter(buf)
+	if err != nil {
+		t.Fatalf("new archive writer failed with %v", err)
+	}
+	for i, header := range headers {
+		if header.Mode == 0 {
+			header.Mode = 0644
+		}
+		header.Size = int64(len(data[i]))
+		if err := aw.Add(header, strings.NewReader(data[i])); err != nil {
+			t.Fatalf("add %s failed with %v", header.Name, err)
+		}
+	}
+	if err := aw.Close(); err != nil {
+		t.Fatalf("close failed with %v", err)
+	}
+	return buf.Bytes()
+}
+
+func extract(t *testing.T, archive []byte, dst string, policy mygzip.ExtractPolicy, opts ...mygzip.Option) error {
+	ar, err := mygzip.NewArchiveReader(bytes.NewReader(archive), opts...)
+	if err != nil {
+		t.Fatalf("new archive reader failed with %v", err)
+	}
+	defer ar.Close()
+	return ar.Extract(dst, policy)
+}
+
+func TestExtractPolicy(t *testing.T) {
+	escape := buildArchive(t, []*tar.Header{
+		{Name: "../evil.txt", Typeflag: tar.TypeReg},
+		{Name: "/abs.txt", Typeflag: tar.TypeReg},
+	}, []string{"evil", "abs"})
+
+	root := t.TempDir()
+	dst := filepath.Join(root, "dst")
+	err := extract(t, escape, dst, mygzip.ExtractPolicy{})
+	var extractErr *mygzip.ExtractError
+	if !errors.As(err, &extractErr) || !errors.Is(err, mygzip.ErrPathEscape) || extractErr.Name != "../evil.txt" {
+		t.Fatalf("want ErrPathEscape but get %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(root, "evil.txt")); err == nil {
+		t.Fatalf("evil.txt written outside dst")
+	}
+
+	if err := extract(t, escape, dst, mygzip.ExtractPolicy{Paths: mygzip.SanitizeEscaping}); err != nil {
+		t.Fatalf("sanitize failed with %v", err)
+	}
+	for _, name := range []string{"evil.txt", "abs.txt"} {
+		if _, err := os.Stat(filepath.Join(dst, name)); err != nil {
+			t.Fatalf("sanitized %s not in dst: %v", name, err)
+		}
+	}
+
+	links := buildArchive(t, []*tar.Header{
+		{Name: "a.txt", Typeflag: tar.TypeReg},
+		{Name: "sym", Typeflag: tar.TypeSymlink, Linkname: "a.txt"},
+		{Name: "hard", Typeflag: tar.TypeLink, Linkname: "a.txt"},
+	}, []string{"hello", "", ""})
+	dst = t.TempDir()
+	if err := extract(t, links, dst, mygzip.ExtractPolicy{}); err != nil {
+		t.Fatalf("skip links failed with %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(dst, "sym")); err == nil {
+		t.Fatalf("symlink want skipped but created")
+	}
+	if err := extract(t, links, t.TempDir(), mygzip.ExtractPolicy{Symlinks: mygzip.RejectLinks}); !errors.Is(err, mygzip.ErrLinkNotAllowed) {
+		t.Fatalf("want ErrLinkNotAllowed but get %v", err)
+	}
+	dst = t.TempDir()
+	allow := mygzip.ExtractPolicy{Symlinks: mygzip.AllowLinks, Hardlinks: mygzip.AllowLinks}
+	if err := extract(t, links, dst, allow); err != nil {
+		t.Fatalf("allow links failed with %v", err)
+	}
+	for _, name := range []string{"sym", "hard"} {
+		data, err := os.ReadFile(filepath.Join(dst, name))
+		if err != nil || string(data) != "hello" {
+			t.Fatalf("%s want hello but get %q, %v", name, data, err)
+		}
+	}
+
+	//链接指向外部，或者通过链接写到外部
+	for _, headers := range [][]*tar.Header{
+		{{Name: "sym", Typeflag: tar.TypeSymlink, Linkname: "../outside"}},
+		{{Name: "sym", Typeflag: tar.TypeSymlink, Linkname: "/etc/passwd"}},
+		{{Name: "hard", Typeflag: tar.TypeLink, Linkname: "../outside"}},
+	} {
+		archive := buildArchive(t, headers, []string{""})
+		if err := extract(t, archive, t.TempDir(), allow); !errors.Is(err, mygzip.ErrLinkEscape) {
+			t.Fatalf("%s want ErrLinkEscape but get %v", headers[0].Linkname, err)
+		}
+	}
+	dst = t.TempDir()
+	if err := os.Symlink(root, filepath.Join(dst, "out")); err != nil {
+		t.Fatalf("symlink failed with %v", err)
+	}
+	through := buildArchive(t, []*tar.Header{{Name: "out/x.txt", Typeflag: tar.TypeReg}}, []string{"x"})
+	if err := extract(t, through, dst, allow); !errors.Is(err, mygzip.ErrLinkEscape) {
+		t.Fatalf("write through symlink want ErrLinkEscape but get %v", err)
+	}
+
+	//多个链接串起来跳出解压目录，文本检查看不出来
+	root = t.TempDir()
+	dst = filepath.Join(root, "a", "b", "dst")
+	chained := buildArchive(t, []*tar.Header{
+		{Name: "l", Typeflag: tar.TypeSymlink, Linkname: "."},
+		{Name: "l/l/l/l/up", Typeflag: tar.TypeSymlink, Linkname: "../../.."},
+		{Name: "up/created-outside/", Typeflag: tar.TypeDir, Mode: 0755},
+	}, []string{"", "", ""})
+	if err := extract(t, chained, dst, mygzip.DefaultExtractPolicy()); !errors.Is(err, mygzip.ErrLinkEscape) {
+		t.Fatalf("chained symlink want ErrLinkEscape but get %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(root, "created-outside")); err == nil {
+		t.Fatalf("created-outside created outside dst")
+	}
+
+	//目录条目经过dst中已有的链接
+	dst = t.TempDir()
+	if err := os.Symlink(root, filepath.Join(dst, "up")); err != nil {
+		t.Fatalf("symlink failed with %v", err)
+	}
+	dirThrough := buildArchive(t, []*tar.Header{{Name: "up/created-outside/", Typeflag: tar.TypeDir, Mode: 0755}}, []string{""})
+	if err := extract(t, dirThrough, dst, mygzip.ExtractPolicy{}); !errors.Is(err, mygzip.ErrLinkEscape) {
+		t.Fatalf("dir through symlink want ErrLinkEscape but get %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(root, "created-outside")); err == nil {
+		t.Fatalf("created-outside created outside dst")
+	}
+
+	//不保留硬链接时复制源文件，源文件是指到外部的链接时不能读取
+	if err := os.WriteFile(filepath.Join(root, "secret"), []byte("secret"), 0600); err != nil {
+		t.Fatalf("write file failed with %v", err)
+	}
+	dst = t.TempDir()
+	if err := os.Symlink(filepath.Join(root, "secret"), filepath.Join(dst, "s")); err != nil {
+		t.Fatalf("symlink failed with %v", err)
+	}
+	copyLink := buildArchive(t, []*tar.Header{{Name: "h", Typeflag: tar.TypeLink, Linkname: "s"}}, []string{""})
+	noHardlinks := mygzip.WithPreserve(mygzip.DefaultPreserve &^ mygzip.PreserveHardlinks)
+	if err := extract(t, copyLink, dst, allow, noHardlinks); !errors.Is(err, mygzip.ErrLinkNotAllowed) {
+		t.Fatalf("hardlink to symlink want ErrLinkNotAllowed but get %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(dst, "h")); err == nil {
+		t.Fatalf("h copied from outside dst")
+	}
+
+	many := buildArchive(t, []*tar.Header{
+		{Name: "1.txt", Typeflag: tar.TypeReg},
+		{Name: "2.txt", Typeflag: tar.TypeReg},
+		{Name: "3.txt", Typeflag: tar.TypeReg},
+	}, []string{"1", "22", "333"})
+	if err := extract(t, many, t.TempDir(), mygzip.ExtractPolicy{MaxEntries: 2}); !errors.Is(err, mygzip.ErrTooManyEntries) {
+		t.Fatalf("want ErrTooManyEntries but get %v", err)
+	}
+	if err := extract(t, many, t.TempDir(), mygzip.ExtractPolicy{MaxBytes: 5}); !errors.Is(err, mygzip.ErrTooLarge) {
+		t.Fatalf("want ErrTooLarge but get %v", err)
+	}
+
+	bomb := buildArchive(t, []*tar.Header{{Name: "zeros", Typeflag: tar.TypeReg}}, []string{strings.Repeat("\x00", 4<<20)})
+	if err := extract(t, bomb, t.TempDir(), mygzip.DefaultExtractPolicy()); !errors.Is(err, mygzip.ErrRatioExceeded) {
+		t.Fatalf("want ErrRatioExceeded but get %v", err)
+	}
+	if err := extract(t, bomb, t.TempDir(), mygzip.ExtractPolicy{}); err != nil {
+		t.Fatalf("no limit failed with %v", err)
+	}
+}
@@ -0,0 +1,145 @@
+package mygzip_test
+
+import (
+	"archive/tar"
+	"bytes"
+	"compress/gzip"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"errors"
+	"os"
+	"path/filepath"
+	"strings"
+	"test/mycrypto"
+	"test/mygzip"
+	"testing"
+)
+
+func writeSrc(t *testing.T) string {
+	dir := filepath.Join(t.TempDir(), "src")
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatalf("mkdir failed with %v", err)
+	}
+	files := map[string]string{
+		"a.txt":     "hello",
+		"sub/b.bin": strings.Repeat("0123456789", 20000), //跨多个chunk
+	}
+	for name, content := range files {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte(content), 0644); err != nil {
+			t.Fatalf("write file failed with %v", err)
+		}
+	}
+	return dir
+}
+
+func checkDst(t *testing.T, dst string) {
+	data, err := os.ReadFile(filepath.Join(dst, "src", "sub", "b.bin"))
+	if err != nil || string(data) != strings.Repeat("0123456789", 20000) {
+		t.Fatalf("b.bin wrong: %d bytes, %v", len(data), err)
+	}
+	data, err = os.ReadFile(filepath.Join(dst, "src", "a.txt"))
+	if err != nil || string(data) != "hello" {
+		t.Fatalf("a.txt wrong: %q, %v", data, err)
+	}
+}
+
+func TestEncryptedRoundTrip(t *testing.T) {
+	src := writeSrc(t)
+	archive := filepath.Join(t.TempDir(), "a.tar.gz")
+	key := []byte("secret")
+	if err := mygzip.Gzip(archive, mygzip.BestSpeed, mygzip.AES256, key, src); err != nil {
+		t.Fatalf("gzip failed with %v", err)
+	}
+
+	dst := t.TempDir()
+	if err := mygzip.UnGzip(dst, archive, mygzip.AES256, key); err != nil {
+		t.Fatalf("ungzip failed with %v", err)
+	}
+	checkDst(t, dst)
+
+	if err := mygzip.UnGzip(t.TempDir(), archive, mygzip.AES256, []byte("wrong")); !errors.Is(err, mycrypto.ErrAuthFailed) {
+		t.Fatalf("wrong key want ErrAuthFailed but get %v", err)
+	}
+
+	//同一个key两次加密结果不同
+	again := filepath.Join(t.TempDir(), "b.tar.gz")
+	if err := mygzip.Gzip(again, mygzip.BestSpeed, mygzip.AES256, key, src); err != nil {
+		t.Fatalf("gzip failed with %v", err)
+	}
+	first, _ := os.ReadFile(archive)
+	second, _ := os.ReadFile(again)
+	if bytes.Equal(first[:64], second[:64]) {
+		t.Fatalf("two archives share header and keystream")
+	}
+}
+
+func TestRelativeSource(t *testing.T) {
+	src := writeSrc(t)
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("getwd failed with %v", err)
+	}
+	if err := os.Chdir(filepath.Dir(src)); err != nil {
+		t.Fatalf("chdir failed with %v", err)
+	}
+	defer os.Chdir(wd)
+
+	//没有Clean过的路径，条目名仍然以src开头
+	for _, p := range []string{"./src", "src/", ".//src", "sub/../src"} {
+		archive := filepath.Join(t.TempDir(), "a.tar.gz")
+		if err := mygzip.Gzip(archive, mygzip.BestSpeed, 0, nil, p); err != nil {
+			t.Fatalf("gzip %s failed with %v", p, err)
+		}
+		dst := t.TempDir()
+		if err := mygzip.UnGzip(dst, archive, 0, nil); err != nil {
+			t.Fatalf("ungzip %s failed with %v", p, err)
+		}
+		checkDst(t, dst)
+		entries, _ := os.ReadDir(dst)
+		if len(entries) != 1 {
+			t.Fatalf("gzip %s extracted %d top level entries", p, len(entries))
+		}
+	}
+}
+
+func TestLegacyFormat(t *testing.T) {
+	src := writeSrc(t)
+	archive := filepath.Join(t.TempDir(), "legacy.tar.gz")
+	key := []byte("secret")
+
+	//按旧格式生成：AES-OFB，固定IV
+	hash := sha256.Sum256(key)
+	block, _ := aes.NewCipher(hash[:mygzip.AES192])
+	file, err := os.Create(archive)
+	if err != nil {
+		t.Fatalf("create failed with %v", err)
+	}
+	gw := gzip.NewWriter(&cipher.StreamWriter{S: cipher.NewOFB(block, []byte("0123456789abcdef")), W: file})
+	tw := tar.NewWriter(gw)
+	filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		header, _ := tar.FileInfoHeader(info, path)
+		rel, _ := filepath.Rel(filepath.Dir(src), path)
+		header.Name = rel
+		tw.WriteHeader(header)
+		if !info.IsDir() {
+			data, _ := os.ReadFile(path)
+			tw.Write(data)
+		}
+		return nil
+	})
+	tw.Close()
+	gw.Close()
+	file.Close()
+
+	//没有校验的旧格式默认不接受
+	if err := mygzip.UnGzip(t.TempDir(), archive, mygzip.AES192, key); !errors.Is(err, mycrypto.ErrBadHeader) {
+		t.Fatalf("ungzip legacy without option want ErrBadHeader but get %v", err)
+	}
+
+	dst := t.TempDir()
+	if err := mygzip.UnGzip(dst, archive, mygzip.AES192, key, mygzip.WithLegacyFormat()); err != nil {
+		t.Fatalf("ungzip legacy failed with %v", err)
+	}
+	checkDst(t, dst)
+}
@@ -0,0 +1,28 @@
+package mygzip
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/sha256"
+	"fmt"
+	"io"
+)
+
+// NewLegacyReader 读取旧格式（AES-OFB，固定IV，没有校验）加密的数据，只用于兼容旧的归档，新数据使用NewEncryptWriter
+func NewLegacyReader(r io.Reader, encryptType int, key []byte) (io.Reader, error) {
+	if encryptType != AES128 && encryptType != AES192 && encryptType != AES256 {
+		return nil, fmt.Errorf("encryptType not support(support AES128,AES192,AES256)")
+	}
+	hash := sha256.New()
+	if _, err := hash.Write(key); err != nil {
+		return nil, err
+	}
+	block, err := aes.NewCipher(hash.Sum(nil)[:encryptType])
+	if err != nil {
+		return nil, err
+	}
+
+	// 创建一个 AES 加密流
+	stream := cipher.NewOFB(block, []byte("0123456789abcdef"))
+	return &cipher.StreamReader{S: stream, R: r}, nil
+}
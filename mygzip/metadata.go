@@ -0,0 +1,159 @@
+package mygzip
+
+import (
+	"archive/tar"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Preserve 打包和解压时保留哪些元数据，可以按位组合
+type Preserve int
+
+const (
+	PreserveSymlinks  Preserve = 1 << iota //打包时记录符号链接，解压时创建；关闭时跳过符号链接
+	PreserveHardlinks                      //打包时同一个inode只写一次内容，其余写成硬链接；关闭时每个都写成普通文件
+	PreserveOwner                          //解压时设置uid/gid，通常需要root权限
+	PreserveXattrs                         //扩展属性，写成PAX的SCHILY.xattr记录，只支持linux，解压时只恢复user.开头的
+	PreserveTimes                          //解压时设置修改时间
+	PreservePerms                          //解压时设置权限位，不受umask影响；关闭时按umask创建
+	PreserveAllXattrs                      //解压时也恢复security.、trusted.等其他命名空间，只用于可信的归档
+
+	// DefaultPreserve 除了uid/gid以外都保留
+	DefaultPreserve = PreserveSymlinks | PreserveHardlinks | PreserveXattrs | PreserveTimes | PreservePerms
+)
+
+const (
+	paxXattr  = "SCHILY.xattr." //扩展属性在PAX记录中的前缀，和GNU tar、bsdtar相同
+	userXattr = "user."
+)
+
+// WithPreserve 设置保留的元数据，默认DefaultPreserve，对ArchiveWriter.AddPath和ArchiveReader.Extract有效
+func WithPreserve(p Preserve) Option {
+	return func(c *archiveConfig) {
+		c.preserve = p
+	}
+}
+
+// fileID 用于识别指向同一个inode的硬链接
+type fileID struct {
+	dev uint64
+	ino uint64
+}
+
+// AddPath 写入本地的文件或者目录，条目名以path的最后一级开头，和Gzip相同。
+// 符号链接不会跟随，其他类型的特殊文件跳过
+func (aw *ArchiveWriter) AddPath(p string) error {
+	//filepath.Walk传入的路径都经过Clean，p也要Clean才能算出相对路径
+	p = filepath.Clean(p)
+	_, basePath := filepath.Split(p)
+	links := make(map[fileID]string)
+	return filepath.Walk(p, func(file string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, err := filepath.Rel(p, file)
+		if err != nil {
+			return err
+		}
+		name := filepath.ToSlash(filepath.Join(basePath, rel))
+
+		mode := info.Mode()
+		var linkname string
+		switch {
+		case mode&os.ModeSymlink != 0:
+			if aw.preserve&PreserveSymlinks == 0 {
+				return nil
+			}
+			if linkname, err = os.Readlink(file); err != nil {
+				return err
+			}
+		case mode.IsDir(), mode.IsRegular():
+		default:
+			return nil
+		}
+
+		header, err := tar.FileInfoHeader(info, linkname)
+		if err != nil {
+			return err
+		}
+		header.Name = name
+		if mode.IsDir() {
+			header.Name += "/"
+		}
+
+		//同一个inode第二次出现时写成硬链接
+		if mode.IsRegular() && aw.preserve&PreserveHardlinks != 0 {
+			if id, ok := hardlinkID(info); ok {
+				if first, ok := links[id]; ok {
+					header.Typeflag = tar.TypeLink
+					header.Linkname = first
+					header.Size = 0
+					return aw.Add(header, nil)
+				}
+				links[id] = header.Name
+			}
+		}
+
+		if mode&os.ModeSymlink == 0 && aw.preserve&PreserveXattrs != 0 {
+			xattrs, err := listXattrs(file)
+			if err != nil {
+				return err
+			}
+			for k, v := range xattrs {
+				if header.PAXRecords == nil {
+					header.PAXRecords = make(map[string]string)
+				}
+				header.PAXRecords[paxXattr+k] = v
+			}
+		}
+
+		if !mode.IsRegular() {
+			return aw.Add(header, nil)
+		}
+		f, err := os.Open(file)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		return aw.Add(header, f)
+	})
+}
+
+// applyMeta 按preserve设置解压出的文件的权限、属主、扩展属性和修改时间，目录在所有条目解压完之后设置
+func (e *extractor) applyMeta(target string, header *tar.Header) error {
+	preserve := e.ar.preserve
+	symlink := header.Typeflag == tar.TypeSymlink
+	if preserve&PreservePerms != 0 && !symlink {
+		if err := os.Chmod(target, header.FileInfo().Mode().Perm()); err != nil {
+			return err
+		}
+	}
+	if preserve&PreserveOwner != 0 {
+		if err := os.Lchown(target, header.Uid, header.Gid); err != nil {
+			return err
+		}
+	}
+	if preserve&PreserveXattrs != 0 && !symlink {
+		for k, v := range header.PAXRecords {
+			if !strings.HasPrefix(k, paxXattr) {
+				continue
+			}
+			name := strings.TrimPrefix(k, paxXattr)
+			//归档可能来自用户上传，默认不设置security.capability之类的属性
+			if preserve&PreserveAllXattrs == 0 && !strings.HasPrefix(name, userXattr) {
+				continue
+			}
+			if err := setXattr(target, name, v); err != nil {
+				return err
+			}
+		}
+	}
+	//os.Chtimes会跟随符号链接，符号链接不设置时间
+	if preserve&PreserveTimes != 0 && !symlink {
+		if err := os.Chtimes(target, header.AccessTime, header.ModTime); err != nil {
+			return err
+		}
+	}
+	return nil
+}
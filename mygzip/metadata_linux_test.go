@@ -0,0 +1,180 @@
+//go:build linux
+
+package mygzip_test
+
+import (
+	"archive/tar"
+	"errors"
+	"os"
+	"path/filepath"
+	"syscall"
+	"test/mygzip"
+	"testing"
+	"time"
+)
+
+// writeMetaSrc 返回源目录和是否支持扩展属性
+func writeMetaSrc(t *testing.T) (string, bool) {
+	dir := filepath.Join(t.TempDir(), "src")
+	if err := os.MkdirAll(filepath.Join(dir, "sub"), 0755); err != nil {
+		t.Fatalf("mkdir failed with %v", err)
+	}
+	file := filepath.Join(dir, "sub", "a.txt")
+	if err := os.WriteFile(file, []byte("hello"), 0600); err != nil {
+		t.Fatalf("write file failed with %v", err)
+	}
+	if err := os.Chmod(file, 0750); err != nil {
+		t.Fatalf("chmod failed with %v", err)
+	}
+	if err := os.Link(file, filepath.Join(dir, "hard.txt")); err != nil {
+		t.Fatalf("link failed with %v", err)
+	}
+	if err := os.Symlink("sub/a.txt", filepath.Join(dir, "sym")); err != nil {
+		t.Fatalf("symlink failed with %v", err)
+	}
+	xattr := true
+	if err := syscall.Setxattr(file, "user.mygzip", []byte("v\x01"), 0); err != nil {
+		if !errors.Is(err, syscall.ENOTSUP) && !errors.Is(err, syscall.EPERM) {
+			t.Fatalf("setxattr failed with %v", err)
+		}
+		xattr = false
+	}
+	mtime := time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+	for _, p := range []string{file, filepath.Join(dir, "sub")} {
+		if err := os.Chtimes(p, mtime, mtime); err != nil {
+			t.Fatalf("chtimes failed with %v", err)
+		}
+	}
+	if err := os.Chmod(filepath.Join(dir, "sub"), 0710); err != nil {
+		t.Fatalf("chmod failed with %v", err)
+	}
+	return dir, xattr
+}
+
+func TestMetadataRoundTrip(t *testing.T) {
+	src, xattr := writeMetaSrc(t)
+	archive := filepath.Join(t.TempDir(), "meta.tar.gz")
+	if err := mygzip.GzipWithOptions(archive, []string{src}, mygzip.WithPreserve(mygzip.DefaultPreserve|mygzip.PreserveOwner)); err != nil {
+		t.Fatalf("gzip failed with %v", err)
+	}
+
+	dst := t.TempDir()
+	if err := mygzip.UnGzip(dst, archive, 0, nil, mygzip.WithPreserve(mygzip.DefaultPreserve|mygzip.PreserveOwner)); err != nil {
+		t.Fatalf("ungzip failed with %v", err)
+	}
+	file := filepath.Join(dst, "src", "sub", "a.txt")
+	fi, err := os.Stat(file)
+	if err != nil {
+		t.Fatalf("stat failed with %v", err)
+	}
+	if fi.Mode().Perm() != 0750 {
+		t.Fatalf("a.txt perm want 0750 but get %v", fi.Mode().Perm())
+	}
+	if !fi.ModTime().Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Fatalf("a.txt mtime wrong: %v", fi.ModTime())
+	}
+	if st := fi.Sys().(*syscall.Stat_t); int(st.Uid) != os.Getuid() || st.Nlink != 2 {
+		t.Fatalf("a.txt want uid %d nlink 2 but get %d %d", os.Getuid(), st.Uid, st.Nlink)
+	}
+	hard, err := os.Stat(filepath.Join(dst, "src", "hard.txt"))
+	if err != nil || !os.SameFile(fi, hard) {
+		t.Fatalf("hard.txt not a hard link of a.txt: %v", err)
+	}
+	if link, err := os.Readlink(filepath.Join(dst, "src", "sym")); err != nil || link != "sub/a.txt" {
+		t.Fatalf("sym want sub/a.txt but get %q, %v", link, err)
+	}
+	sub, err := os.Stat(filepath.Join(dst, "src", "sub"))
+	if err != nil || sub.Mode().Perm() != 0710 || !sub.ModTime().Equal(fi.ModTime()) {
+		t.Fatalf("sub dir metadata wrong: %v, %v", sub, err)
+	}
+	if xattr {
+		value := make([]byte, 16)
+		n, err := syscall.Getxattr(file, "user.mygzip", value)
+		if err != nil || string(value[:n]) != "v\x01" {
+			t.Fatalf("xattr want %q but get %q, %v", "v\x01", value[:n], err)
+		}
+	} else {
+		t.Log("xattrs not supported, skip xattr check")
+	}
+
+	//关闭各项后按原来的方式解压
+	dst = t.TempDir()
+	off := mygzip.WithPreserve(mygzip.PreserveHardlinks)
+	if err := mygzip.UnGzip(dst, archive, 0, nil, off); err != nil {
+		t.Fatalf("ungzip failed with %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(dst, "src", "sym")); err == nil {
+		t.Fatalf("sym want skipped but created")
+	}
+	fi, err = os.Stat(filepath.Join(dst, "src", "sub", "a.txt"))
+	if err != nil || fi.ModTime().Equal(time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)) {
+		t.Fatalf("a.txt mtime want now but get %v, %v", fi, err)
+	}
+
+	noLinks := filepath.Join(t.TempDir(), "nolinks.tar.gz")
+	if err := mygzip.GzipWithOptions(noLinks, []string{src}, mygzip.WithPreserve(mygzip.PreserveTimes)); err != nil {
+		t.Fatalf("gzip failed with %v", err)
+	}
+	dst = t.TempDir()
+	if err := mygzip.UnGzip(dst, noLinks, 0, nil); err != nil {
+		t.Fatalf("ungzip failed with %v", err)
+	}
+	a, _ := os.Stat(filepath.Join(dst, "src", "sub", "a.txt"))
+	hard, err = os.Stat(filepath.Join(dst, "src", "hard.txt"))
+	if err != nil || os.SameFile(a, hard) {
+		t.Fatalf("hard.txt want separate file: %v", err)
+	}
+	if _, err := os.Lstat(filepath.Join(dst, "src", "sym")); err == nil {
+		t.Fatalf("sym want not archived")
+	}
+}
+
+func TestXattrNamespaces(t *testing.T) {
+	archive := buildArchive(t, []*tar.Header{{
+		Name:     "a.txt",
+		Typeflag: tar.TypeReg,
+		PAXRecords: map[string]string{
+			"SCHILY.xattr.user.ok":             "yes",
+			"SCHILY.xattr.trusted.mygzip":      "no",
+			"SCHILY.xattr.security.capability": "no",
+		},
+	}}, []string{"hello"})
+
+	dst := t.TempDir()
+	if err := extract(t, archive, dst, mygzip.DefaultExtractPolicy()); err != nil {
+		t.Fatalf("extract failed with %v", err)
+	}
+	file := filepath.Join(dst, "a.txt")
+	value := make([]byte, 16)
+	n, err := syscall.Getxattr(file, "user.ok", value)
+	if errors.Is(err, syscall.ENOTSUP) {
+		t.Skip("xattrs not supported")
+	}
+	if err != nil || string(value[:n]) != "yes" {
+		t.Fatalf("user.ok want yes but get %q, %v", value[:n], err)
+	}
+	//默认只恢复user.开头的
+	for _, name := range []string{"trusted.mygzip", "security.capability"} {
+		if _, err := syscall.Getxattr(file, name, value); err == nil {
+			t.Fatalf("%s restored from untrusted archive", name)
+		}
+	}
+
+	//显式开启时恢复其他命名空间，需要root
+	if os.Getuid() != 0 {
+		return
+	}
+	dst = t.TempDir()
+	all := mygzip.WithPreserve(mygzip.DefaultPreserve | mygzip.PreserveAllXattrs)
+	archive = buildArchive(t, []*tar.Header{{
+		Name:       "a.txt",
+		Typeflag:   tar.TypeReg,
+		PAXRecords: map[string]string{"SCHILY.xattr.trusted.mygzip": "yes"},
+	}}, []string{"hello"})
+	if err := extract(t, archive, dst, mygzip.DefaultExtractPolicy(), all); err != nil {
+		t.Fatalf("extract failed with %v", err)
+	}
+	if n, err := syscall.Getxattr(filepath.Join(dst, "a.txt"), "trusted.mygzip", value); err != nil || string(value[:n]) != "yes" {
+		t.Fatalf("trusted.mygzip want yes but get %q, %v", value[:n], err)
+	}
+}
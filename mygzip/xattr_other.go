@@ -0,0 +1,19 @@
+//go:build !linux
+
+package mygzip
+
+import "os"
+
+// hardlinkID 其他平台不识别硬链接，都写成普通文件
+func hardlinkID(info os.FileInfo) (fileID, bool) {
+	return fileID{}, false
+}
+
+func listXattrs(path string) (map[string]string, error) {
+	return nil, nil
+}
+
+// setXattr 其他平台不支持扩展属性，和listXattrs一样跳过
+func setXattr(path, name, value string) error {
+	return nil
+}
@@ -12,6 +12,7 @@ import (
 	"path"
 	"path/filepath"
 	"strings"
+	"test/mycrypto"
 )
 
 // Zip compresses the specified files or dirs to zip archive.
@@ -22,6 +23,7 @@ import (
 // ├── bar.txt
 // └── foo.txt
 // Note that if a file is a symbolic link it will be skipped.
+// If key is not nil the archive is encrypted in mycrypto format with AES256, key can be any passphrase.
 func Zip(zipPath string, key []byte, paths ...string) error {
 	// Create zip file and it's parent dir.
 	if err := os.MkdirAll(filepath.Dir(zipPath), os.ModePerm); err != nil {
@@ -33,22 +35,16 @@ func Zip(zipPath string, key []byte, paths ...string) error {
 	}
 	defer outFile.Close()
 
-	var zipWriter *zip.Writer
+	var w io.Writer = outFile
+	var encryptWriter io.WriteCloser
 	if key != nil {
-		block, err := aes.NewCipher([]byte(key))
+		encryptWriter, err = mycrypto.NewEncryptWriter(outFile, mycrypto.AES256, key)
 		if err != nil {
 			return err
 		}
-
-		// 创建一个 AES 加密流
-		stream := cipher.NewOFB(block, []byte("0123456789abcdef"))
-		writer := &cipher.StreamWriter{S: stream, W: outFile}
-		zipWriter = zip.NewWriter(writer)
-		defer zipWriter.Close()
-	} else {
-		zipWriter = zip.NewWriter(outFile)
-		defer zipWriter.Close()
+		w = encryptWriter
 	}
+	zipWriter := zip.NewWriter(w)
 
 	// Traverse the file or directory.
 	for _, rootPath := range paths {
@@ -105,9 +101,64 @@ func Zip(zipPath string, key []byte, paths ...string) error {
 		}
 	}
 
+	// Close in order, the last encrypted frame is written by Close.
+	if err := zipWriter.Close(); err != nil {
+		return err
+	}
+	if encryptWriter != nil {
+		return encryptWriter.Close()
+	}
 	return nil
 }
 
+// Option configures Unzip and UnEncrypt.
+type Option func(*config)
+
+type config struct {
+	legacy bool
+}
+
+// WithLegacyFormat also accepts data encrypted by the old format, which is not authenticated
+// and can be tampered with undetected. Only use it to migrate old archives from a trusted source.
+func WithLegacyFormat() Option {
+	return func(c *config) {
+		c.legacy = true
+	}
+}
+
+func newConfig(opts []Option) *config {
+	c := &config{}
+	for _, opt := range opts {
+		opt(c)
+	}
+	return c
+}
+
+// newLegacyReader reads data encrypted by the old format: AES-OFB with the raw key and a fixed IV,
+// key must be 16, 24 or 32 bytes.
+func newLegacyReader(r io.Reader, key []byte) (io.Reader, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	// 创建一个 AES 加密流
+	stream := cipher.NewOFB(block, []byte("0123456789abcdef"))
+	return &cipher.StreamReader{S: stream, R: r}, nil
+}
+
+// newReader detects the format by magic, the old format is only accepted with WithLegacyFormat,
+// otherwise mycrypto.ErrBadHeader is returned.
+func newReader(r io.Reader, key []byte, c *config) (io.Reader, error) {
+	var legacy func(r io.Reader) (io.Reader, error)
+	if c.legacy {
+		legacy = func(r io.Reader) (io.Reader, error) {
+			return newLegacyReader(r, key)
+		}
+	}
+	return mycrypto.NewReader(r, key, legacy)
+}
+
 type unbufferedReaderAt struct {
 	R io.Reader
 	N int64
@@ -136,7 +187,8 @@ func (u *unbufferedReaderAt) ReadAt(p []byte, off int64) (n int, err error) {
 // Unzip decompresses a zip file to specified directory.
 // Note that the destination directory don't need to specify the trailing path separator.
 // If the destination directory doesn't exist, it will be created automatically.
-func Unzip(zipath, dir string, key []byte) error {
+// If key is not nil the archive must be in mycrypto format unless WithLegacyFormat is given.
+func Unzip(zipath, dir string, key []byte, opts ...Option) error {
 	// Open zip file.
 	file, err := os.Open(zipath)
 	// reader, err := zip.OpenReader(zipath)
@@ -150,21 +202,27 @@ func Unzip(zipath, dir string, key []byte) error {
 		return err
 	}
 
-	var r io.Reader
+	var readerAt io.ReaderAt = file
+	size := fi.Size()
 	if key != nil {
-		block, err := aes.NewCipher([]byte(key))
+		// zip needs random access, decrypt to a temp file first, every frame is verified before written.
+		r, err := newReader(file, key, newConfig(opts))
 		if err != nil {
 			return err
 		}
-
-		// 创建一个 AES 加密流
-		stream := cipher.NewOFB(block, []byte("0123456789abcdef"))
-		r = &cipher.StreamReader{S: stream, R: file}
-	} else {
-		r = file
+		tmp, err := os.CreateTemp("", "unzip-*")
+		if err != nil {
+			return err
+		}
+		defer os.Remove(tmp.Name())
+		defer tmp.Close()
+		if size, err = io.Copy(tmp, r); err != nil {
+			return err
+		}
+		readerAt = tmp
 	}
 
-	reader, err := zip.NewReader(NewUnbufferedReaderAt(r), fi.Size())
+	reader, err := zip.NewReader(readerAt, size)
 	if err != nil {
 		return err
 	}
@@ -213,7 +271,7 @@ func unzipFile(file *zip.File, dir string) error {
 	return err
 }
 
-// 16,24,32
+// Encrypt 使用mycrypto的格式加密，passwd可以是任意长度的口令
 func Encrypt(src, dst, passwd string) error {
 	// 打开要加密的压缩包文件
 	zipFile, err := os.Open(src)
@@ -229,49 +287,45 @@ func Encrypt(src, dst, passwd string) error {
 	}
 	defer encryptedZipFile.Close()
 
-	block, err := aes.NewCipher([]byte(passwd))
+	writer, err := mycrypto.NewEncryptWriter(encryptedZipFile, mycrypto.AES256, []byte(passwd))
 	if err != nil {
 		return err
 	}
 
-	// 创建一个 AES 加密流
-	stream := cipher.NewOFB(block, []byte("0123456789abcdef"))
-	writer := &cipher.StreamWriter{S: stream, W: encryptedZipFile}
-
 	_, err = io.Copy(writer, zipFile)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	return writer.Close()
 }
 
-func UnEncrypt(src, dst, passwd string) error {
+// UnEncrypt 只接受mycrypto的格式，使用WithLegacyFormat时也接受旧格式，旧格式的passwd必须是16、24或32字节。
+// 校验失败时删除dst，不会留下部分解密的数据
+func UnEncrypt(src, dst, passwd string, opts ...Option) error {
 	encryptedFile, err := os.Open(src)
 	if err != nil {
 		return err
 	}
 	defer encryptedFile.Close()
 
-	file, err := os.Create(dst)
+	reader, err := newReader(encryptedFile, []byte(passwd), newConfig(opts))
 	if err != nil {
 		return err
 	}
-	defer file.Close()
 
-	block, err := aes.NewCipher([]byte(passwd))
+	file, err := os.Create(dst)
 	if err != nil {
 		return err
 	}
-
-	// 创建一个 AES 加密流
-	stream := cipher.NewOFB(block, []byte("0123456789abcdef"))
-	reader := &cipher.StreamReader{S: stream, R: encryptedFile}
-
-	_, err = io.Copy(file, reader)
-	if err != nil {
+	if _, err = io.Copy(file, reader); err != nil {
+		file.Close()
+		os.Remove(dst)
+		return err
+	}
+	if err := file.Close(); err != nil {
+		os.Remove(dst)
 		return err
 	}
-
 	return nil
 }
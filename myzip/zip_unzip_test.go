@@ -1 +1,102 @@
 package myzip_test
+
+import (
+	"crypto/aes"
+	"crypto/cipher"
+	"errors"
+	"os"
+	"path/filepath"
+	"test/mycrypto"
+	"test/myzip"
+	"testing"
+)
+
+func TestZipWithPassphrase(t *testing.T) {
+	dir := t.TempDir()
+	src := filepath.Join(dir, "src")
+	if err := os.MkdirAll(src, 0755); err != nil {
+		t.Fatalf("mkdir failed with %v", err)
+	}
+	if err := os.WriteFile(filepath.Join(src, "a.txt"), []byte("hello"), 0644); err != nil {
+		t.Fatalf("write file failed with %v", err)
+	}
+
+	//口令不需要是16、24或32字节
+	archive := filepath.Join(dir, "a.zip")
+	key := []byte("any passphrase")
+	if err := myzip.Zip(archive, key, src); err != nil {
+		t.Fatalf("zip failed with %v", err)
+	}
+	dst := filepath.Join(dir, "dst")
+	if err := myzip.Unzip(archive, dst, key); err != nil {
+		t.Fatalf("unzip failed with %v", err)
+	}
+	if data, err := os.ReadFile(filepath.Join(dst, "src", "a.txt")); err != nil || string(data) != "hello" {
+		t.Fatalf("a.txt get %q, %v", data, err)
+	}
+	if err := myzip.Unzip(archive, filepath.Join(dir, "bad"), []byte("wrong")); err == nil {
+		t.Fatalf("unzip with wrong key want err but not")
+	}
+}
+
+func TestEncrypt(t *testing.T) {
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "plain")
+	if err := os.WriteFile(plain, []byte("some archive"), 0644); err != nil {
+		t.Fatalf("write file failed with %v", err)
+	}
+
+	encrypted, decrypted := filepath.Join(dir, "encrypted"), filepath.Join(dir, "decrypted")
+	if err := myzip.Encrypt(plain, encrypted, "short"); err != nil {
+		t.Fatalf("encrypt failed with %v", err)
+	}
+	if err := myzip.UnEncrypt(encrypted, decrypted, "short"); err != nil {
+		t.Fatalf("unencrypt failed with %v", err)
+	}
+	if data, _ := os.ReadFile(decrypted); string(data) != "some archive" {
+		t.Fatalf("decrypted get %q", data)
+	}
+
+	//旧格式：原始key，固定IV的AES-OFB
+	key := "0123456789abcdef"
+	block, _ := aes.NewCipher([]byte(key))
+	legacy := make([]byte, len("some archive"))
+	cipher.NewOFB(block, []byte("0123456789abcdef")).XORKeyStream(legacy, []byte("some archive"))
+	if err := os.WriteFile(encrypted, legacy, 0644); err != nil {
+		t.Fatalf("write file failed with %v", err)
+	}
+	if err := myzip.UnEncrypt(encrypted, filepath.Join(dir, "rejected"), key); !errors.Is(err, mycrypto.ErrBadHeader) {
+		t.Fatalf("unencrypt legacy without option want ErrBadHeader but get %v", err)
+	}
+	if err := myzip.UnEncrypt(encrypted, decrypted, key, myzip.WithLegacyFormat()); err != nil {
+		t.Fatalf("unencrypt legacy failed with %v", err)
+	}
+	if data, _ := os.ReadFile(decrypted); string(data) != "some archive" {
+		t.Fatalf("decrypted legacy get %q", data)
+	}
+}
+
+func TestUnEncryptTampered(t *testing.T) {
+	dir := t.TempDir()
+	plain := filepath.Join(dir, "plain")
+	if err := os.WriteFile(plain, make([]byte, 200*1024), 0644); err != nil {
+		t.Fatalf("write file failed with %v", err)
+	}
+	encrypted, decrypted := filepath.Join(dir, "encrypted"), filepath.Join(dir, "decrypted")
+	if err := myzip.Encrypt(plain, encrypted, "passwd"); err != nil {
+		t.Fatalf("encrypt failed with %v", err)
+	}
+
+	//改最后一帧，前面的帧已经校验通过并写入dst
+	data, _ := os.ReadFile(encrypted)
+	data[len(data)-1] ^= 1
+	if err := os.WriteFile(encrypted, data, 0644); err != nil {
+		t.Fatalf("write file failed with %v", err)
+	}
+	if err := myzip.UnEncrypt(encrypted, decrypted, "passwd"); !errors.Is(err, mycrypto.ErrAuthFailed) {
+		t.Fatalf("unencrypt tampered want ErrAuthFailed but get %v", err)
+	}
+	if _, err := os.Stat(decrypted); !os.IsNotExist(err) {
+		t.Fatalf("partial plaintext left in dst: %v", err)
+	}
+}
@@ -0,0 +1,152 @@
+package threadpool
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"runtime/debug"
+	"strings"
+	"sync"
+)
+
+// ErrorMode 决定ForEachLimit遇到错误后的行为
+type ErrorMode int
+
+const (
+	StopOnError ErrorMode = iota //默认，第一个错误取消ctx，不再开始新的item，返回第一个错误
+	CollectAll                   //所有item都执行，返回所有错误组成的MultiError
+)
+
+// ItemError 是第Index个item返回的错误
+type ItemError struct {
+	Index int
+	Err   error
+}
+
+func (e *ItemError) Error() string {
+	return fmt.Sprintf("item %d: %v", e.Index, e.Err)
+}
+
+func (e *ItemError) Unwrap() error {
+	return e.Err
+}
+
+// MultiError CollectAll模式下返回，按item下标排序，ctx取消时最后一个为ctx.Err()
+type MultiError []error
+
+func (me MultiError) Error() string {
+	msgs := make([]string, 0, len(me))
+	for _, err := range me {
+		msgs = append(msgs, err.Error())
+	}
+	return fmt.Sprintf("%d errors: %s", len(me), strings.Join(msgs, "; "))
+}
+
+// Is 任意一个错误匹配即可
+func (me MultiError) Is(target error) bool {
+	for _, err := range me {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// ForEachLimit 最多limit个协程并发对items执行fn，每个item只执行一次，等待所有已开始的fn返回后返回。
+// ctx结束后不再开始新的item；fn panic时转换为PanicError。
+// StopOnError模式返回第一个错误（*ItemError）或者ctx.Err()，CollectAll模式返回MultiError
+func ForEachLimit[T any](ctx context.Context, items []T, limit int, fn func(ctx context.Context, idx int, item T) error, mode ...ErrorMode) error {
+	if limit <= 0 {
+		return fmt.Errorf("bad limit %d", limit)
+	}
+	errMode := StopOnError
+	if len(mode) > 0 {
+		errMode = mode[0]
+	}
+	if limit > len(items) {
+		limit = len(items)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	mu := sync.Mutex{}
+	next := 0
+	errs := make([]error, len(items))
+	var first error
+	//take 返回下一个要执行的item下标，没有或者需要停止时返回-1
+	take := func() int {
+		mu.Lock()
+		defer mu.Unlock()
+		if next >= len(items) || ctx.Err() != nil {
+			return -1
+		}
+		next++
+		return next - 1
+	}
+
+	wg := sync.WaitGroup{}
+	for i := 0; i < limit; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for idx := take(); idx >= 0; idx = take() {
+				err := callItem(ctx, idx, items[idx], fn)
+				if err == nil {
+					continue
+				}
+				err = &ItemError{Index: idx, Err: err}
+				mu.Lock()
+				errs[idx] = err
+				if first == nil {
+					first = err
+				}
+				mu.Unlock()
+				if errMode == StopOnError {
+					cancel()
+				}
+			}
+		}()
+	}
+	wg.Wait()
+
+	//外部ctx结束导致的提前退出
+	var ctxErr error
+	if first == nil || errMode == CollectAll {
+		mu.Lock()
+		if next < len(items) {
+			ctxErr = ctx.Err()
+		}
+		mu.Unlock()
+	}
+
+	if errMode == StopOnError {
+		if first != nil {
+			return first
+		}
+		return ctxErr
+	}
+
+	me := make(MultiError, 0)
+	for _, err := range errs {
+		if err != nil {
+			me = append(me, err)
+		}
+	}
+	if ctxErr != nil {
+		me = append(me, ctxErr)
+	}
+	if len(me) == 0 {
+		return nil
+	}
+	return me
+}
+
+func callItem[T any](ctx context.Context, idx int, item T, fn func(ctx context.Context, idx int, item T) error) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return fn(ctx, idx, item)
+}
@@ -0,0 +1,105 @@
+package threadpool_test
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"sync/atomic"
+	"test/threadpool"
+	"testing"
+	"time"
+)
+
+func TestForEachLimit(t *testing.T) {
+	items := make([]int, 100)
+	for i := range items {
+		items[i] = i
+	}
+
+	//每个item只执行一次，并发不超过limit
+	var running, peak atomic.Int32
+	seen := make([]atomic.Int32, len(items))
+	err := threadpool.ForEachLimit(context.Background(), items, 8, func(ctx context.Context, idx int, item int) error {
+		n := running.Add(1)
+		for {
+			old := peak.Load()
+			if n <= old || peak.CompareAndSwap(old, n) {
+				break
+			}
+		}
+		seen[item].Add(1)
+		time.Sleep(time.Millisecond)
+		running.Add(-1)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("for each failed with %v", err)
+	}
+	for i := range seen {
+		if seen[i].Load() != 1 {
+			t.Fatalf("item %d run %d times", i, seen[i].Load())
+		}
+	}
+	if peak.Load() > 8 {
+		t.Fatalf("%d items run at the same time", peak.Load())
+	}
+
+	if err := threadpool.ForEachLimit(context.Background(), items, 0, func(ctx context.Context, idx int, item int) error { return nil }); err == nil {
+		t.Fatalf("for each with bad limit want err but not")
+	}
+	if err := threadpool.ForEachLimit(context.Background(), []int{}, 4, func(ctx context.Context, idx int, item int) error { return nil }); err != nil {
+		t.Fatalf("for each on empty items failed with %v", err)
+	}
+}
+
+func TestForEachLimitErrors(t *testing.T) {
+	items := make([]int, 50)
+	errOdd := errors.New("odd")
+	fn := func(ctx context.Context, idx int, item int) error {
+		if item == 7 {
+			panic("boom")
+		}
+		if item%2 == 1 {
+			return errOdd
+		}
+		return nil
+	}
+	for i := range items {
+		items[i] = i
+	}
+
+	//失败后不再开始新的item
+	var started atomic.Int32
+	err := threadpool.ForEachLimit(context.Background(), items, 1, func(ctx context.Context, idx int, item int) error {
+		started.Add(1)
+		return fn(ctx, idx, item)
+	})
+	var itemErr *threadpool.ItemError
+	if !errors.As(err, &itemErr) || itemErr.Index != 1 || !errors.Is(err, errOdd) || started.Load() != 2 {
+		t.Fatalf("stop on error get %v after %d items", err, started.Load())
+	}
+
+	err = threadpool.ForEachLimit(context.Background(), items, 4, fn, threadpool.CollectAll)
+	var me threadpool.MultiError
+	if !errors.As(err, &me) || len(me) != 25 || !errors.Is(err, errOdd) {
+		t.Fatalf("collect all get %v", err)
+	}
+	var panicErr *threadpool.PanicError
+	if !errors.As(me[3], &panicErr) {
+		t.Fatalf("item 7 want PanicError but get %v", me[3])
+	}
+
+	//ctx取消后不再开始新的item
+	ctx, cancel := context.WithCancel(context.Background())
+	var count atomic.Int32
+	once := sync.Once{}
+	err = threadpool.ForEachLimit(ctx, items, 2, func(ctx context.Context, idx int, item int) error {
+		if count.Add(1) == 5 {
+			once.Do(cancel)
+		}
+		return nil
+	})
+	if !errors.Is(err, context.Canceled) || count.Load() >= int32(len(items)) {
+		t.Fatalf("cancelled for each get %v after %d items", err, count.Load())
+	}
+}
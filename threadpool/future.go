@@ -0,0 +1,42 @@
+package threadpool
+
+import "fmt"
+
+// Future 是Submit提交的任务的结果
+type Future struct {
+	done   chan struct{}
+	result interface{}
+	err    error
+}
+
+func newFuture() *Future {
+	return &Future{done: make(chan struct{})}
+}
+
+// resolve 只能调用一次
+func (f *Future) resolve(result interface{}, err error) {
+	f.result = result
+	f.err = err
+	close(f.done)
+}
+
+// Wait 等待任务结束，返回任务的结果和错误
+func (f *Future) Wait() (interface{}, error) {
+	<-f.done
+	return f.result, f.err
+}
+
+// Done 任务结束时关闭
+func (f *Future) Done() <-chan struct{} {
+	return f.done
+}
+
+// PanicError 任务panic时返回的错误，Stack为panic时的调用栈
+type PanicError struct {
+	Value interface{}
+	Stack []byte
+}
+
+func (e *PanicError) Error() string {
+	return fmt.Sprintf("job panic: %v", e.Value)
+}
@@ -0,0 +1,114 @@
+package threadpool
+
+import (
+	"context"
+)
+
+// lane 保存同一个key上等待的任务，同一时间只有一个任务在队列里或者正在执行
+type lane struct {
+	pending []*task
+}
+
+// AddKeyed 提交任务，key相同的任务按提交顺序逐个执行，key不同的任务并行执行。
+// key上已经有任务在排队或执行时，新任务挂在这个key后面，同样占用队列空位，队列满时按policy处理；
+// 前一个任务执行完后才把它放入队列，和其他任务一样由dispatch交给空闲协程
+func (tp *ThreadPool) AddKeyed(key string, job Job) error {
+	return tp.add(&task{ctx: context.Background(), job: jobAdapter{job: job}, orig: job, priority: priorityOf(job), keyed: true, key: key})
+}
+
+// place 把已经占用空位的任务放入队列，key上已经有任务时挂在后面，调用者持有mu
+func (tp *ThreadPool) place(t *task) {
+	tp.stamp(t)
+	if t.keyed {
+		if l, ok := tp.lanes[t.key]; ok {
+			l.pending = append(l.pending, t)
+			return
+		}
+		tp.lanes[t.key] = &lane{}
+	}
+	tp.queue.push(t)
+}
+
+// advance key上的任务执行完或者被丢弃后，把下一个任务放入队列，没有时删除这个key，调用者持有mu
+func (tp *ThreadPool) advance(key string) {
+	l := tp.lanes[key]
+	if len(l.pending) == 0 {
+		delete(tp.lanes, key)
+		return
+	}
+	t := l.pending[0]
+	l.pending[0] = nil
+	l.pending = l.pending[1:]
+	tp.queue.push(t)
+}
+
+// finish key上的任务执行完后调用
+func (tp *ThreadPool) finish(key string) {
+	tp.mu.Lock()
+	tp.advance(key)
+	tp.mu.Unlock()
+	tp.notify()
+}
+
+// oldestLane 返回等待的任务中有最早任务（优先级模式下为最后才会执行的任务）的key，没有时返回nil，调用者持有mu
+func (tp *ThreadPool) oldestLane() *lane {
+	var oldest *lane
+	for _, l := range tp.lanes {
+		if len(l.pending) > 0 && (oldest == nil || tp.before(l.oldest(tp.priority), oldest.oldest(tp.priority))) {
+			oldest = l
+		}
+	}
+	return oldest
+}
+
+// oldest key上的任务按提交顺序执行，第一个最早，最后一个最后才会执行
+func (l *lane) oldest(priority bool) *task {
+	if priority {
+		return l.pending[len(l.pending)-1]
+	}
+	return l.pending[0]
+}
+
+func (l *lane) popOldest(priority bool) *task {
+	n := len(l.pending)
+	if priority {
+		t := l.pending[n-1]
+		l.pending[n-1] = nil
+		l.pending = l.pending[:n-1]
+		return t
+	}
+	t := l.pending[0]
+	l.pending[0] = nil
+	l.pending = l.pending[1:]
+	return t
+}
+
+// before DropOldest应该先丢弃a而不是b时返回true
+func (tp *ThreadPool) before(a, b *task) bool {
+	if !tp.priority {
+		return a.seq < b.seq
+	}
+	if a.score != b.score {
+		return a.score < b.score
+	}
+	return a.seq > b.seq
+}
+
+// laneLen 返回key上等待的任务数，调用者持有mu
+func (tp *ThreadPool) laneLen() int {
+	n := 0
+	for _, l := range tp.lanes {
+		n += len(l.pending)
+	}
+	return n
+}
+
+// drainLanes 取出所有key上等待的任务，ShutdownNow时调用，调用者持有mu
+func (tp *ThreadPool) drainLanes() []*task {
+	tasks := make([]*task, 0)
+	for _, l := range tp.lanes {
+		tasks = append(tasks, l.pending...)
+		l.pending = nil
+	}
+	return tasks
+}
@@ -0,0 +1,112 @@
+package threadpool
+
+import (
+	"errors"
+	"time"
+)
+
+type Option func(*ThreadPool) error
+
+// WithThreads 设置初始协程数和最大协程数，和NewThreadPool的两个参数相同
+func WithThreads(beginning, max int32) Option {
+	return func(tp *ThreadPool) error {
+		if beginning <= 0 || max < beginning {
+			return errors.New("bad params")
+		}
+		tp.maxIdle.Store(beginning)
+		tp.min = beginning
+		tp.max = max
+		return nil
+	}
+}
+
+// WithKeepAlive 设置空闲协程的存活时间，超过初始协程数的协程空闲d后退出，默认DefaultKeepAlive
+func WithKeepAlive(d time.Duration) Option {
+	return func(tp *ThreadPool) error {
+		if d <= 0 {
+			return errors.New("bad keep alive")
+		}
+		tp.keepAlive = d
+		return nil
+	}
+}
+
+// WithQueue 设置任务队列长度和队列满时的处理策略，默认DefaultQueueSize和Block
+func WithQueue(size int, policy OverflowPolicy) Option {
+	return func(tp *ThreadPool) error {
+		if size <= 0 {
+			return errors.New("bad queue size")
+		}
+		if policy < Block || policy > CallerRuns {
+			return errors.New("bad overflow policy")
+		}
+		tp.queueSize = size
+		tp.policy = policy
+		return nil
+	}
+}
+
+// WithPriority 开启优先级模式，实现了PriorityJob的任务按优先级从高到低执行，
+// 每等待aging时间优先级加1，防止低优先级任务饿死，aging为0时不老化
+func WithPriority(aging time.Duration) Option {
+	return func(tp *ThreadPool) error {
+		if aging < 0 {
+			return errors.New("bad aging")
+		}
+		tp.priority = true
+		tp.aging = aging
+		return nil
+	}
+}
+
+// WithBuckets 设置Stats中排队时间和执行时间直方图的分桶上界，需要升序，默认DefaultBuckets
+func WithBuckets(bounds ...time.Duration) Option {
+	return func(tp *ThreadPool) error {
+		for i := 1; i < len(bounds); i++ {
+			if bounds[i] <= bounds[i-1] {
+				return errors.New("bad buckets")
+			}
+		}
+		tp.buckets = append([]time.Duration(nil), bounds...)
+		return nil
+	}
+}
+
+// WithBeforeJob 设置任务开始执行前的钩子
+func WithBeforeJob(hook Hook) Option {
+	return func(tp *ThreadPool) error {
+		tp.beforeJob = hook
+		return nil
+	}
+}
+
+// WithAfterJob 设置任务执行完后的钩子，可以用来记录慢任务
+func WithAfterJob(hook Hook) Option {
+	return func(tp *ThreadPool) error {
+		tp.afterJob = hook
+		return nil
+	}
+}
+
+// WithRateLimit 限制任务开始执行的速率，每秒最多rate个，允许突发burst个，
+// AddKeyed提交的任务和重试同样计入
+func WithRateLimit(rate float64, burst int) Option {
+	return func(tp *ThreadPool) error {
+		if rate <= 0 || burst <= 0 {
+			return errors.New("bad rate limit")
+		}
+		tp.limiter = newTokenBucket(rate, burst)
+		return nil
+	}
+}
+
+// WithRetry 设置所有任务默认的重试策略，实现了RetryJob的任务使用自己的策略
+func WithRetry(policy RetryPolicy) Option {
+	return func(tp *ThreadPool) error {
+		if policy.InitialBackoff < 0 || policy.MaxBackoff < 0 || policy.Jitter < 0 || policy.Jitter > 1 {
+			return errors.New("bad retry policy")
+		}
+		tp.retry = &policy
+		return nil
+	}
+}
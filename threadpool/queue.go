@@ -0,0 +1,172 @@
+package threadpool
+
+import (
+	"container/heap"
+	"container/list"
+	"errors"
+)
+
+const DefaultQueueSize = 1024
+
+var (
+	ErrQueueFull = errors.New("thread pool queue is full")
+	ErrDropped   = errors.New("job dropped from thread pool queue")
+)
+
+// OverflowPolicy 任务队列满时的处理策略
+type OverflowPolicy int
+
+const (
+	Block      OverflowPolicy = iota //等待队列有空位，提交的ctx结束时返回
+	FailFast                         //直接返回ErrQueueFull
+	DropOldest                       //丢弃队列里最早的任务（优先级模式下为最后才会执行的任务），包括挂在key后面的任务，被丢弃的任务的Future返回ErrDropped
+	CallerRuns                       //在提交任务的协程里直接执行，AddKeyed的key上已经有任务时等待空位
+)
+
+func (p OverflowPolicy) String() string {
+	switch p {
+	case Block:
+		return "block"
+	case FailFast:
+		return "fail-fast"
+	case DropOldest:
+		return "drop-oldest"
+	case CallerRuns:
+		return "caller-runs"
+	default:
+		return "unknown"
+	}
+}
+
+// jobQueue 等待执行的任务，所有方法都由调用者持有ThreadPool.mu
+type jobQueue interface {
+	push(t *task)
+	pop() *task
+	oldest() *task //DropOldest时丢弃的任务，不取出
+	popOldest() *task
+	len() int
+}
+
+type fifoQueue struct {
+	tasks *list.List
+}
+
+func newFifoQueue() *fifoQueue {
+	return &fifoQueue{tasks: list.New()}
+}
+
+func (q *fifoQueue) push(t *task) {
+	q.tasks.PushBack(t)
+}
+
+func (q *fifoQueue) pop() *task {
+	e := q.tasks.Front()
+	if e == nil {
+		return nil
+	}
+	return q.tasks.Remove(e).(*task)
+}
+
+func (q *fifoQueue) oldest() *task {
+	e := q.tasks.Front()
+	if e == nil {
+		return nil
+	}
+	return e.Value.(*task)
+}
+
+func (q *fifoQueue) popOldest() *task {
+	return q.pop()
+}
+
+func (q *fifoQueue) len() int {
+	return q.tasks.Len()
+}
+
+// 实现这个接口的任务在优先级模式下按Priority从大到小执行，没有实现的优先级为0
+type PriorityJob interface {
+	Priority() int
+}
+
+func priorityOf(job interface{}) int {
+	if pj, ok := job.(PriorityJob); ok {
+		return pj.Priority()
+	}
+	return 0
+}
+
+// priorityQueue 按score从大到小出队，score相同时先入队的先出。
+// score = priority*aging - 入队时间，等价于任务每等待aging时间优先级加1，
+// 低优先级任务等待足够久后会排到高优先级任务前面，不会一直饿死。aging为0时不老化
+type priorityQueue struct {
+	tasks []*task
+}
+
+func newPriorityQueue() *priorityQueue {
+	return &priorityQueue{}
+}
+
+func (q *priorityQueue) Len() int { return len(q.tasks) }
+
+func (q *priorityQueue) Less(i, j int) bool {
+	if q.tasks[i].score != q.tasks[j].score {
+		return q.tasks[i].score > q.tasks[j].score
+	}
+	return q.tasks[i].seq < q.tasks[j].seq
+}
+
+func (q *priorityQueue) Swap(i, j int) { q.tasks[i], q.tasks[j] = q.tasks[j], q.tasks[i] }
+
+func (q *priorityQueue) Push(x interface{}) { q.tasks = append(q.tasks, x.(*task)) }
+
+func (q *priorityQueue) Pop() interface{} {
+	n := len(q.tasks)
+	t := q.tasks[n-1]
+	q.tasks[n-1] = nil
+	q.tasks = q.tasks[:n-1]
+	return t
+}
+
+func (q *priorityQueue) push(t *task) {
+	heap.Push(q, t)
+}
+
+func (q *priorityQueue) pop() *task {
+	if len(q.tasks) == 0 {
+		return nil
+	}
+	return heap.Pop(q).(*task)
+}
+
+// last 返回最后才会执行的任务的下标，队列为空时返回-1
+func (q *priorityQueue) last() int {
+	if len(q.tasks) == 0 {
+		return -1
+	}
+	last := 0
+	for i := 1; i < len(q.tasks); i++ {
+		if q.Less(last, i) {
+			last = i
+		}
+	}
+	return last
+}
+
+func (q *priorityQueue) oldest() *task {
+	if i := q.last(); i >= 0 {
+		return q.tasks[i]
+	}
+	return nil
+}
+
+// popOldest 优先级模式下丢弃最后才会执行的任务
+func (q *priorityQueue) popOldest() *task {
+	if i := q.last(); i >= 0 {
+		return heap.Remove(q, i).(*task)
+	}
+	return nil
+}
+
+func (q *priorityQueue) len() int {
+	return len(q.tasks)
+}
@@ -0,0 +1,78 @@
+package threadpool
+
+import (
+	"context"
+	"errors"
+	"math/rand"
+	"time"
+)
+
+// RetryPolicy 任务返回错误或者panic时的重试策略。
+// 重试在同一个协程里进行，退避期间占用协程，AddKeyed提交的任务重试时同一个key的后续任务继续等待。
+// 设置了WithRateLimit时每次重试前也要取令牌
+type RetryPolicy struct {
+	MaxAttempts    int                                            //最多执行次数，包括第一次，不大于1时不重试
+	InitialBackoff time.Duration                                  //第一次重试前的等待时间
+	MaxBackoff     time.Duration                                  //等待时间上限，0表示不限制
+	Multiplier     float64                                        //每次重试等待时间的倍数，不大于1时为2
+	Jitter         float64                                        //等待时间随机浮动的比例，0到1
+	Retryable      func(err error) bool                           //判断错误是否可以重试，nil时除了ctx取消以外都重试
+	DeadLetter     func(job interface{}, err error, attempts int) //最后一次执行仍然失败时调用，job为提交的原始任务
+}
+
+// 需要单独重试策略的任务实现这个接口，优先于WithRetry设置的策略，返回nil时不重试
+type RetryJob interface {
+	RetryPolicy() *RetryPolicy
+}
+
+// retryPolicyOf 任务自己的策略优先
+func (tp *ThreadPool) retryPolicyOf(job interface{}) *RetryPolicy {
+	if rj, ok := job.(RetryJob); ok {
+		return rj.RetryPolicy()
+	}
+	return tp.retry
+}
+
+func (rp *RetryPolicy) retryable(err error) bool {
+	if rp.Retryable != nil {
+		return rp.Retryable(err)
+	}
+	return !errors.Is(err, context.Canceled) && !errors.Is(err, context.DeadlineExceeded)
+}
+
+// backoff 第attempt次执行失败后的等待时间
+func (rp *RetryPolicy) backoff(attempt int) time.Duration {
+	multiplier := rp.Multiplier
+	if multiplier <= 1 {
+		multiplier = 2
+	}
+	d := float64(rp.InitialBackoff)
+	for i := 1; i < attempt; i++ {
+		d *= multiplier
+		if rp.MaxBackoff > 0 && d > float64(rp.MaxBackoff) {
+			break
+		}
+	}
+	if rp.MaxBackoff > 0 && d > float64(rp.MaxBackoff) {
+		d = float64(rp.MaxBackoff)
+	}
+	if rp.Jitter > 0 {
+		d += d * rp.Jitter * (2*rand.Float64() - 1)
+	}
+	return time.Duration(d)
+}
+
+// sleep 等待d，ctx结束时返回false
+func sleep(ctx context.Context, d time.Duration) bool {
+	if d <= 0 {
+		return ctx.Err() == nil
+	}
+	timer := time.NewTimer(d)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-ctx.Done():
+		return false
+	}
+}
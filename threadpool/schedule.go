@@ -0,0 +1,116 @@
+package threadpool
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+)
+
+// Scheduled 是Schedule和ScheduleEvery返回的句柄，用来取消还没提交的任务
+type Scheduled struct {
+	once   sync.Once
+	cancel chan struct{}
+	done   chan struct{}
+	mu     sync.Mutex
+	err    error //最近一次提交失败的原因
+}
+
+func newScheduled() *Scheduled {
+	return &Scheduled{cancel: make(chan struct{}), done: make(chan struct{})}
+}
+
+// Cancel 停止之后的提交，已经提交到线程池的任务不受影响，可以多次调用
+func (s *Scheduled) Cancel() {
+	s.once.Do(func() { close(s.cancel) })
+}
+
+// Done 不会再提交任务时关闭：延迟任务已经提交、被取消或者线程池已经停止
+func (s *Scheduled) Done() <-chan struct{} {
+	return s.done
+}
+
+// Err 返回最近一次提交到线程池失败的错误（例如ErrQueueFull），或者提交后被丢弃的错误（ErrDropped），没有失败时返回nil。
+// Schedule的任务因为线程池停止没有提交时返回ErrStopped，Done关闭后结果不再改变
+func (s *Scheduled) Err() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.err
+}
+
+func (s *Scheduled) setErr(err error) {
+	s.mu.Lock()
+	s.err = err
+	s.mu.Unlock()
+}
+
+// Schedule delay之后提交任务，提交失败的错误通过Scheduled.Err返回
+func (tp *ThreadPool) Schedule(job Job, delay time.Duration) (*Scheduled, error) {
+	if tp.stop.Load() {
+		return nil, ErrStopped
+	}
+
+	s := newScheduled()
+	go func() {
+		defer close(s.done)
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+			if err := tp.Add(job); err != nil {
+				s.setErr(err)
+			}
+		case <-s.cancel:
+		case <-tp.closing:
+			s.setErr(ErrStopped)
+		}
+	}()
+	return s, nil
+}
+
+// ScheduleEvery 每隔interval提交一次任务，第一次在interval之后。
+// 上一次提交的任务还没执行完时跳过这一次，同一个周期任务不会同时执行。
+// 提交失败或者提交后被丢弃（DropOldest、ShutdownNow）时通过Scheduled.Err返回，下一次照常提交
+func (tp *ThreadPool) ScheduleEvery(job Job, interval time.Duration) (*Scheduled, error) {
+	if interval <= 0 {
+		return nil, errors.New("bad interval")
+	}
+	if tp.stop.Load() {
+		return nil, ErrStopped
+	}
+
+	s := newScheduled()
+	go func() {
+		defer close(s.done)
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		var last *Future //上一次提交的任务，执行完或者被丢弃后为nil
+		var done <-chan struct{}
+		for {
+			select {
+			case <-ticker.C:
+				if last != nil {
+					continue
+				}
+				last = tp.submit(&task{ctx: context.Background(), job: jobAdapter{job: job}, orig: job, priority: priorityOf(job)})
+				done = last.Done()
+			case <-done:
+				_, err := last.Wait()
+				last, done = nil, nil
+				//任务自己panic不算提交失败，只计入Stats().Failed
+				var pe *PanicError
+				if err != nil && !errors.As(err, &pe) {
+					s.setErr(err)
+					if errors.Is(err, ErrStopped) {
+						return
+					}
+				}
+			case <-s.cancel:
+				return
+			case <-tp.closing:
+				return
+			}
+		}
+	}()
+	return s, nil
+}
@@ -0,0 +1,121 @@
+package threadpool
+
+import (
+	"sync/atomic"
+	"time"
+)
+
+// DefaultBuckets 是排队时间和执行时间直方图的默认分桶上界，最后还有一个+Inf桶
+var DefaultBuckets = []time.Duration{
+	time.Millisecond,
+	5 * time.Millisecond,
+	10 * time.Millisecond,
+	50 * time.Millisecond,
+	100 * time.Millisecond,
+	500 * time.Millisecond,
+	time.Second,
+	5 * time.Second,
+	10 * time.Second,
+}
+
+// Stats 是线程池的统计快照，计数从线程池创建开始累计
+type Stats struct {
+	Submitted  uint64    //提交成功的任务数
+	Completed  uint64    //执行成功的任务数
+	Failed     uint64    //返回错误或者panic的任务数，重试的任务只统计最后一次
+	Retried    uint64    //重试的次数
+	Rejected   uint64    //提交失败的任务数
+	Dropped    uint64    //提交成功但没有执行的任务数，被DropOldest丢弃或者停止时丢弃
+	QueueDepth int       //当前排队的任务数，包括挂在key后面的任务
+	Active     int32     //当前正在执行任务的协程数
+	Threads    int32     //当前协程数
+	QueueWait  Histogram //从提交到开始执行的时间
+	RunTime    Histogram //任务执行时间
+}
+
+// Histogram Counts[i]为落在(Bounds[i-1], Bounds[i]]内的次数，不累加，
+// Counts[len(Bounds)]为超过所有上界的次数。导出为Prometheus的le桶时需要依次累加Counts
+type Histogram struct {
+	Bounds []time.Duration
+	Counts []uint64
+	Count  uint64
+	Sum    time.Duration
+}
+
+// JobInfo 传给BeforeJob和AfterJob钩子，RunTime和Err只在AfterJob中有值，任务重试时每次执行都会调用
+type JobInfo struct {
+	Job       interface{} //提交时的Job、ContextJob或ResultJob
+	Priority  int
+	Attempt   int //第几次执行，从1开始
+	QueueWait time.Duration
+	RunTime   time.Duration
+	Err       error
+}
+
+// 在执行任务的协程中调用，不能阻塞太久，也不能panic
+type Hook func(info JobInfo)
+
+type histogram struct {
+	bounds []time.Duration
+	counts []atomic.Uint64
+	count  atomic.Uint64
+	sum    atomic.Int64
+}
+
+func newHistogram(bounds []time.Duration) *histogram {
+	return &histogram{bounds: bounds, counts: make([]atomic.Uint64, len(bounds)+1)}
+}
+
+func (h *histogram) observe(d time.Duration) {
+	i := 0
+	for i < len(h.bounds) && d > h.bounds[i] {
+		i++
+	}
+	h.counts[i].Add(1)
+	h.count.Add(1)
+	h.sum.Add(int64(d))
+}
+
+func (h *histogram) snapshot() Histogram {
+	snap := Histogram{
+		Bounds: append([]time.Duration(nil), h.bounds...),
+		Counts: make([]uint64, len(h.counts)),
+		Count:  h.count.Load(),
+		Sum:    time.Duration(h.sum.Load()),
+	}
+	for i := range h.counts {
+		snap.Counts[i] = h.counts[i].Load()
+	}
+	return snap
+}
+
+type poolStats struct {
+	submitted atomic.Uint64
+	completed atomic.Uint64
+	failed    atomic.Uint64
+	retried   atomic.Uint64
+	rejected  atomic.Uint64
+	dropped   atomic.Uint64
+	queueWait *histogram
+	runTime   *histogram
+}
+
+func (tp *ThreadPool) Stats() Stats {
+	tp.mu.Lock()
+	depth := tp.queue.len() + tp.laneLen()
+	tp.mu.Unlock()
+
+	return Stats{
+		Submitted:  tp.stats.submitted.Load(),
+		Completed:  tp.stats.completed.Load(),
+		Failed:     tp.stats.failed.Load(),
+		Retried:    tp.stats.retried.Load(),
+		Rejected:   tp.stats.rejected.Load(),
+		Dropped:    tp.stats.dropped.Load(),
+		QueueDepth: depth,
+		Active:     tp.running.Load(),
+		Threads:    tp.maxIdle.Load(),
+		QueueWait:  tp.stats.queueWait.snapshot(),
+		RunTime:    tp.stats.runTime.snapshot(),
+	}
+}
@@ -1,8 +1,11 @@
 package threadpool
 
 import (
+	"context"
 	"errors"
 	"fmt"
+	"runtime"
+	"runtime/debug"
 	"sync"
 	"sync/atomic"
 	"time"
@@ -11,11 +14,13 @@ import (
 const (
 	DefaultMaxThreads       int32 = 64
 	DefaultBeginningThreads int32 = 8
+	DefaultKeepAlive              = 60 * time.Second
 )
 
-// var (
-// 	logger *logrus.Logger
-// )
+var (
+	ErrStopped = errors.New("thread pool is stopped")
+	// logger *logrus.Logger
+)
 
 // callers need implate this
 type Job interface {
@@ -25,16 +30,95 @@ type Job interface {
 	Worker()
 }
 
+// 需要感知取消的任务实现这个接口，ctx在提交时的ctx结束或者线程池停止时被取消
+type ContextJob interface {
+	Worker(ctx context.Context)
+}
+
+// 需要返回结果或者错误的任务实现这个接口，通过Submit提交，结果从Future获取
+type ResultJob interface {
+	Worker(ctx context.Context) (interface{}, error)
+}
+
+// JobFunc 把普通函数转换为ResultJob
+type JobFunc func(ctx context.Context) (interface{}, error)
+
+func (f JobFunc) Worker(ctx context.Context) (interface{}, error) {
+	return f(ctx)
+}
+
+// jobAdapter 把Job转换为ResultJob
+type jobAdapter struct {
+	job Job
+}
+
+func (ja jobAdapter) Worker(ctx context.Context) (interface{}, error) {
+	ja.job.Worker()
+	return nil, nil
+}
+
+// contextJobAdapter 把ContextJob转换为ResultJob
+type contextJobAdapter struct {
+	job ContextJob
+}
+
+func (ca contextJobAdapter) Worker(ctx context.Context) (interface{}, error) {
+	ca.job.Worker(ctx)
+	return nil, nil
+}
+
+// task 是线程池内部传递的任务
+type task struct {
+	ctx      context.Context //提交任务时的ctx
+	job      ResultJob
+	orig     interface{} //提交的原始任务，ShutdownNow时返回
+	future   *Future     //Add提交的任务为nil
+	priority int         //优先级模式下使用
+	seq      uint64      //入队顺序
+	enqueued time.Time   //提交时间
+	keyed    bool        //AddKeyed提交的任务
+	key      string
+	score    int64 //优先级模式下的出队顺序，见priorityQueue
+}
+
 type ThreadPool struct {
-	maxIdle    atomic.Int32   //当前空闲协程数量, 默认 8
-	max        int32          //最大协程数量，默认64
-	running    atomic.Int32   //当前正在工作的协程数量
-	idle       atomic.Int32   //记录协程编号
-	jobSignal  chan Job       //添加任务信号
-	stopSignal chan struct{}  //停止线程池信号
-	stop       bool           //停止状态
-	growing    bool           //线程扩展中
-	wg         sync.WaitGroup //等待所有协程退出
+	maxIdle    atomic.Int32       //当前协程数量, 默认 8
+	min        int32              //空闲协程退出后至少保留的协程数量，即初始协程数量
+	max        int32              //最大协程数量，默认64
+	keepAlive  time.Duration      //超过min的协程空闲keepAlive后退出
+	running    atomic.Int32       //当前正在工作的协程数量
+	idle       atomic.Int32       //记录协程编号
+	jobSignal  chan *task         //添加任务信号，nil通知等待任务的协程退出
+	ready      chan struct{}      //协程空闲时发送，dispatch收到后才从队列取任务
+	stopSignal chan struct{}      //停止线程池信号
+	stop       atomic.Bool        //停止状态
+	wg         sync.WaitGroup     //等待所有协程和dispatch退出
+	ctx        context.Context    //线程池停止时取消，所有任务的ctx都从它派生
+	cancel     context.CancelFunc //停止线程池时调用
+	mu         sync.Mutex         //保护queue和lanes
+	queue      jobQueue           //等待执行的任务
+	queueSize  int                //队列长度
+	policy     OverflowPolicy     //队列满时的处理策略
+	slots      chan struct{}      //队列空位，容量为queueSize，入队时占用，协程取到任务后释放
+	wake       chan struct{}      //通知dispatch有新任务
+	quit       chan struct{}      //通知dispatch退出
+	closing    chan struct{}      //开始停止时关闭，唤醒阻塞在入队的调用者
+	dispatched chan struct{}      //dispatch退出后关闭
+	drained    chan struct{}      //停止后队列为空且没有正在执行的任务时关闭
+	stopOnce   sync.Once          //关闭closing
+	drainOnce  sync.Once          //关闭drained
+	quitOnce   sync.Once          //关闭quit和stopSignal
+	priority   bool               //优先级模式
+	aging      time.Duration      //优先级模式下每等待aging优先级加1
+	seq        uint64             //入队序号，由mu保护
+	started    time.Time          //线程池创建时间，计算score用
+	stats      poolStats
+	buckets    []time.Duration  //直方图分桶
+	beforeJob  Hook             //任务开始执行前调用
+	afterJob   Hook             //任务执行完后调用
+	lanes      map[string]*lane //AddKeyed提交的任务，key上有任务在执行或排队时存在
+	limiter    *tokenBucket     //限制任务开始执行的速率，nil时不限制
+	retry      *RetryPolicy     //所有任务默认的重试策略，nil时不重试
 }
 
 // func init() {
@@ -50,110 +134,587 @@ type ThreadPool struct {
 // }
 
 func NewThreadPool(elem ...int32) (*ThreadPool, error) {
-	tp := ThreadPool{}
-	tp.jobSignal = make(chan Job)
-	tp.stopSignal = make(chan struct{})
 	args := len(elem)
 	if args > 2 {
 		return nil, errors.New("too many params")
 	}
 
-	if args == 0 {
-		tp.maxIdle.Store(DefaultBeginningThreads)
-		tp.max = DefaultMaxThreads
-	} else if args == 1 {
-		tp.maxIdle.Store(elem[0])
-		if DefaultMaxThreads < tp.maxIdle.Load() {
-			tp.max = tp.maxIdle.Load()
-		} else {
-			tp.max = DefaultMaxThreads
+	beginning, max := DefaultBeginningThreads, DefaultMaxThreads
+	if args == 1 {
+		beginning = elem[0]
+		if DefaultMaxThreads < beginning {
+			max = beginning
 		}
 	} else if args == 2 {
 		if elem[1] < elem[0] {
 			return nil, errors.New("bad params")
 		}
+		beginning, max = elem[0], elem[1]
+	}
+
+	return NewThreadPoolWithOptions(WithThreads(beginning, max))
+}
+
+// NewThreadPoolWithOptions 默认DefaultBeginningThreads个初始协程，最多DefaultMaxThreads个，
+// 队列长度DefaultQueueSize，队列满时阻塞
+func NewThreadPoolWithOptions(opts ...Option) (*ThreadPool, error) {
+	tp := ThreadPool{}
+	tp.maxIdle.Store(DefaultBeginningThreads)
+	tp.min = DefaultBeginningThreads
+	tp.max = DefaultMaxThreads
+	tp.keepAlive = DefaultKeepAlive
+	tp.buckets = DefaultBuckets
+	tp.queueSize = DefaultQueueSize
+	tp.policy = Block
+	for _, opt := range opts {
+		if err := opt(&tp); err != nil {
+			return nil, err
+		}
+	}
 
-		tp.maxIdle.Store(elem[0])
-		tp.max = elem[1]
+	tp.jobSignal = make(chan *task)
+	tp.ready = make(chan struct{})
+	tp.stopSignal = make(chan struct{})
+	tp.ctx, tp.cancel = context.WithCancel(context.Background())
+	tp.started = time.Now()
+	tp.stats.queueWait = newHistogram(tp.buckets)
+	tp.stats.runTime = newHistogram(tp.buckets)
+	if tp.priority {
+		tp.queue = newPriorityQueue()
+	} else {
+		tp.queue = newFifoQueue()
 	}
+	tp.slots = make(chan struct{}, tp.queueSize)
+	tp.wake = make(chan struct{}, 1)
+	tp.quit = make(chan struct{})
+	tp.closing = make(chan struct{})
+	tp.lanes = make(map[string]*lane)
+	tp.dispatched = make(chan struct{})
+	tp.drained = make(chan struct{})
 
 	for i := int32(0); i < tp.maxIdle.Load(); i++ {
-		go tp.thread()
+		tp.spawn()
 	}
+	tp.wg.Add(1)
+	go tp.dispatch()
 
 	return &tp, nil
 }
 
 func (tp *ThreadPool) Describe() string {
-	return fmt.Sprintf("maxIdle %d, max %d, running %d", tp.maxIdle.Load(), tp.max, tp.running.Load())
+	return fmt.Sprintf("maxIdle %d, max %d, running %d, queued %d/%d", tp.maxIdle.Load(), tp.max, tp.running.Load(), len(tp.slots), tp.queueSize)
 }
 
 func (tp *ThreadPool) Add(job Job) error {
-	if tp.stop {
-		return fmt.Errorf("thread poll is stoped")
+	return tp.add(&task{ctx: context.Background(), job: jobAdapter{job: job}, orig: job, priority: priorityOf(job)})
+}
+
+// AddContext 提交任务，在ctx结束时停止等待并返回ctx.Err()；
+// job.Worker收到的ctx在提交的ctx结束或者线程池停止时被取消
+func (tp *ThreadPool) AddContext(ctx context.Context, job ContextJob) error {
+	return tp.add(&task{ctx: ctx, job: contextJobAdapter{job: job}, orig: job, priority: priorityOf(job)})
+}
+
+// Submit 提交任务并返回Future，提交失败时Future直接返回错误
+func (tp *ThreadPool) Submit(job ResultJob) *Future {
+	return tp.SubmitContext(context.Background(), job)
+}
+
+// SubmitContext 同AddContext，ctx结束时停止等待
+func (tp *ThreadPool) SubmitContext(ctx context.Context, job ResultJob) *Future {
+	return tp.submit(&task{ctx: ctx, job: job, orig: job, priority: priorityOf(job)})
+}
+
+// submit 提交任务并返回Future，提交失败、被丢弃或者执行完时Future结束
+func (tp *ThreadPool) submit(t *task) *Future {
+	t.future = newFuture()
+	if err := tp.add(t); err != nil {
+		t.future.resolve(nil, err)
 	}
+	return t.future
+}
 
-	for tp.growing {
-		// logger.Infof("growing, wait")
-		time.Sleep(500 * time.Millisecond)
+// add 协程的扩展由dispatch负责，这里只入队
+func (tp *ThreadPool) add(t *task) error {
+	if tp.stop.Load() {
+		tp.stats.rejected.Add(1)
+		return ErrStopped
+	}
+	if err := t.ctx.Err(); err != nil {
+		tp.stats.rejected.Add(1)
+		return err
 	}
 
-	running := tp.running.Load()
-	maxIdle := tp.maxIdle.Load()
-	if running == maxIdle {
-		tp.growing = true
-		end := int32(0)
-		if 2*maxIdle > tp.max {
-			end = tp.max
-		} else {
-			end = 2 * maxIdle
-		}
-		// logger.Infof("add to %d", end)
+	t.enqueued = time.Now()
+	if err := tp.enqueue(t); err != nil {
+		tp.stats.rejected.Add(1)
+		return err
+	}
+	return nil
+}
+
+// enqueue 把任务放入队列，队列满时按policy处理
+func (tp *ThreadPool) enqueue(t *task) error {
+	select {
+	case tp.slots <- struct{}{}:
+		return tp.push(t)
+	default:
+	}
 
-		for i := running; i < end; i++ {
-			go tp.thread()
+	switch tp.policy {
+	case FailFast:
+		return ErrQueueFull
+	case CallerRuns:
+		if tp.callerRuns(t) {
+			return nil
 		}
+		//key上已经有任务时不能直接执行，等待空位排在它们后面
+	case DropOldest:
+		return tp.replace(t)
+	}
 
-		tp.maxIdle.CompareAndSwap(maxIdle, end)
-		tp.growing = false
+	select {
+	case tp.slots <- struct{}{}:
+		return tp.push(t)
+	case <-t.ctx.Done():
+		return t.ctx.Err()
+	case <-tp.closing:
+		return ErrStopped
 	}
+}
 
-	tp.jobSignal <- job
+// push 调用者已经占用了一个空位。占用空位后在mu内检查停止状态，
+// ShutdownNow先设置stop再取mu清空队列，入队的任务一定会被执行或者被ShutdownNow返回
+func (tp *ThreadPool) push(t *task) error {
+	tp.mu.Lock()
+	if tp.stop.Load() {
+		tp.mu.Unlock()
+		<-tp.slots
+		tp.checkDrained()
+		return ErrStopped
+	}
+	tp.place(t)
+	tp.mu.Unlock()
+	tp.stats.submitted.Add(1)
+	tp.notify()
 	return nil
 }
 
-func (tp *ThreadPool) Stop() {
-	tp.stop = true
-	//等待所有任务执行完成
+// callerRuns 在调用者的协程里执行任务，key上已经有任务在排队或执行时返回false。
+// key上之后的任务放入队列，不在调用者的协程里接着执行
+func (tp *ThreadPool) callerRuns(t *task) bool {
+	if t.keyed {
+		tp.mu.Lock()
+		if _, ok := tp.lanes[t.key]; ok {
+			tp.mu.Unlock()
+			return false
+		}
+		tp.lanes[t.key] = &lane{}
+		tp.mu.Unlock()
+	}
 
-	for tp.running.Load() != 0 {
-		// logger.Infof("has %d running", tp.running.Load())
-		time.Sleep(500 * time.Millisecond)
+	tp.stats.submitted.Add(1)
+	if tp.limiter != nil {
+		time.Sleep(tp.limiter.reserve())
 	}
-	//所有协程退出
-	for i := int32(0); i < tp.maxIdle.Load(); i++ {
-		tp.stopSignal <- struct{}{}
+	tp.running.Add(1)
+	tp.run(t)
+	tp.running.Add(-1)
+	tp.checkDrained()
+	return true
+}
+
+// replace 队列满时丢弃最早的任务，新任务占用它的空位，不会阻塞。
+// dispatch在mu内取出任务并释放空位，所以占用空位的任务都在队列里或者挂在key后面，
+// 只有已经占用空位但还没取到mu的调用者除外，等它们入队后再丢弃
+func (tp *ThreadPool) replace(t *task) error {
+	for {
+		tp.mu.Lock()
+		//和push一样在mu内检查，ShutdownNow先设置stop再取mu清空队列
+		if tp.stop.Load() {
+			tp.mu.Unlock()
+			return ErrStopped
+		}
+		select {
+		case tp.slots <- struct{}{}:
+			tp.place(t)
+			tp.mu.Unlock()
+			tp.stats.submitted.Add(1)
+			tp.notify()
+			return nil
+		default:
+		}
+		//新任务直接占用被丢弃任务的空位，先丢弃再放入，被丢弃的可能是同一个key上的任务
+		if old := tp.evict(); old != nil {
+			tp.place(t)
+			tp.mu.Unlock()
+			tp.stats.submitted.Add(1)
+			tp.notify()
+			tp.discard(old, ErrDropped)
+			return nil
+		}
+		tp.mu.Unlock()
+		runtime.Gosched()
+	}
+}
+
+// evict 取出队列里和key后面等待的任务中最早的，都为空时返回nil，调用者持有mu。
+// 丢弃的是key上排在队列里的任务时，这个key上的下一个任务放入队列
+func (tp *ThreadPool) evict() *task {
+	old := tp.queue.oldest()
+	if l := tp.oldestLane(); l != nil && (old == nil || tp.before(l.oldest(tp.priority), old)) {
+		return l.popOldest(tp.priority)
+	}
+	if old == nil {
+		return nil
+	}
+	tp.queue.popOldest()
+	if old.keyed {
+		tp.advance(old.key)
+	}
+	return old
+}
+
+// discard 丢弃没有执行的任务
+func (tp *ThreadPool) discard(t *task, err error) {
+	tp.stats.dropped.Add(1)
+	if t.future != nil {
+		t.future.resolve(nil, err)
+	}
+}
+
+// stamp 设置入队序号和score，调用者需持有mu
+func (tp *ThreadPool) stamp(t *task) {
+	tp.seq++
+	t.seq = tp.seq
+	t.score = int64(t.priority)*int64(tp.aging) - int64(t.enqueued.Sub(tp.started))
+	if tp.aging == 0 {
+		t.score = int64(t.priority)
 	}
+}
+
+func (tp *ThreadPool) notify() {
+	select {
+	case tp.wake <- struct{}{}:
+	default:
+	}
+}
+
+// dispatch 把队列里的任务交给空闲协程，线程池停止后退出。
+// 先等到空闲协程再从队列取任务，任务在交给协程之前一直在队列里，可以被DropOldest丢弃
+func (tp *ThreadPool) dispatch() {
+	defer tp.wg.Done()
+	defer close(tp.dispatched)
+	token := false  //限速时已经为下一个任务取到令牌
+	worker := false //已经有空闲协程在等待任务
+	defer func() {
+		if worker {
+			tp.jobSignal <- nil
+		}
+	}()
+	for {
+		tp.mu.Lock()
+		empty := tp.queue.len() == 0
+		tp.mu.Unlock()
 
+		if empty {
+			select {
+			case <-tp.wake:
+				continue
+			case <-tp.quit:
+				return
+			}
+		}
+
+		if tp.limiter != nil && !token {
+			if !tp.waitToken(tp.quit) {
+				return
+			}
+			token = true
+		}
+
+		//没有空闲协程时增加一个，协程数不超过max
+		if !worker {
+			select {
+			case <-tp.ready:
+			default:
+				tp.grow()
+				select {
+				case <-tp.ready:
+				case <-tp.quit:
+					return
+				}
+			}
+			worker = true
+		}
+
+		//等待协程时任务可能被丢弃，优先级队列下也可能有更高优先级的任务入队，这时才取
+		tp.mu.Lock()
+		t := tp.queue.pop()
+		if t != nil {
+			//先计入running再释放空位，Shutdown不会在两者之间看到都为0
+			tp.running.Add(1)
+			<-tp.slots
+		}
+		tp.mu.Unlock()
+		if t == nil {
+			continue
+		}
+
+		//协程发送ready后只等待jobSignal，不会阻塞
+		tp.jobSignal <- t
+		token, worker = false, false
+	}
+}
+
+// waitToken 等待令牌，done关闭时返回false
+func (tp *ThreadPool) waitToken(done <-chan struct{}) bool {
+	wait := tp.limiter.reserve()
+	if wait <= 0 {
+		return true
+	}
+	timer := time.NewTimer(wait)
+	defer timer.Stop()
+	select {
+	case <-timer.C:
+		return true
+	case <-done:
+		return false
+	}
+}
+
+// grow 只在dispatch中调用，maxIdle由CAS保护，和空闲协程退出不冲突
+func (tp *ThreadPool) grow() {
+	for {
+		n := tp.maxIdle.Load()
+		if n >= tp.max {
+			return
+		}
+		if tp.maxIdle.CompareAndSwap(n, n+1) {
+			tp.spawn()
+			return
+		}
+	}
+}
+
+// shrink 空闲超时的协程退出前调用，协程数不少于min时返回false
+func (tp *ThreadPool) shrink() bool {
+	for {
+		n := tp.maxIdle.Load()
+		if n <= tp.min {
+			return false
+		}
+		if tp.maxIdle.CompareAndSwap(n, n-1) {
+			return true
+		}
+	}
+}
+
+// spawn 启动一个协程，调用者已经计入maxIdle
+func (tp *ThreadPool) spawn() {
+	tp.wg.Add(1)
+	go tp.thread()
+}
+
+// Stop 通知正在执行的任务退出，并等待队列里和正在执行的任务全部完成，没有超时，
+// 需要限制停止时间时使用Shutdown
+func (tp *ThreadPool) Stop() {
+	tp.cancel()
+	tp.Shutdown(context.Background())
+}
+
+// Shutdown 不再接受新任务，等待队列里的任务和正在执行的任务完成。
+// ctx结束时取消正在执行的任务的ctx，丢弃还没开始的任务（Future返回ErrStopped），
+// 不再等待阻塞的协程，返回ctx.Err()
+func (tp *ThreadPool) Shutdown(ctx context.Context) error {
+	tp.closeInput()
+	tp.checkDrained()
+
+	select {
+	case <-tp.drained:
+	case <-ctx.Done():
+		tp.ShutdownNow()
+		return ctx.Err()
+	}
+
+	tp.quitThreads()
 	tp.wg.Wait()
+	return nil
+}
+
+// ShutdownNow 不再接受新任务，取消正在执行的任务的ctx，返回所有还没开始执行的任务，不等待正在执行的任务。
+// 返回的是提交时的Job、ContextJob或ResultJob，这些任务的Future返回ErrStopped
+func (tp *ThreadPool) ShutdownNow() []interface{} {
+	tp.closeInput()
+	tp.cancel()
+	tp.quitThreads()
+	<-tp.dispatched
+
+	tp.mu.Lock()
+	tasks := make([]*task, 0, tp.queue.len())
+	for t := tp.queue.pop(); t != nil; t = tp.queue.pop() {
+		tasks = append(tasks, t)
+	}
+	//挂在key后面的任务不在队列里，同样占用空位
+	tasks = append(tasks, tp.drainLanes()...)
+	tp.mu.Unlock()
+
+	jobs := make([]interface{}, 0, len(tasks))
+	for _, t := range tasks {
+		<-tp.slots
+		tp.discard(t, ErrStopped)
+		jobs = append(jobs, t.orig)
+	}
+	//同时在等待的Shutdown
+	tp.checkDrained()
+	return jobs
+}
+
+// checkDrained 停止后队列为空且没有正在执行的任务时关闭drained，
+// 在任务执行完或者释放空位后调用
+func (tp *ThreadPool) checkDrained() {
+	if tp.stop.Load() && tp.running.Load() == 0 && len(tp.slots) == 0 {
+		tp.drainOnce.Do(func() {
+			close(tp.drained)
+		})
+	}
+}
+
+// closeInput 停止接受新任务，唤醒阻塞在入队的调用者
+func (tp *ThreadPool) closeInput() {
+	tp.stopOnce.Do(func() {
+		tp.stop.Store(true)
+		close(tp.closing)
+	})
+}
+
+// quitThreads 通知dispatch和所有空闲协程退出，正在执行任务的协程执行完后退出
+func (tp *ThreadPool) quitThreads() {
+	tp.quitOnce.Do(func() {
+		close(tp.quit)
+		close(tp.stopSignal)
+	})
 }
 
 func (tp *ThreadPool) thread() {
+	defer tp.wg.Done()
 	tp.idle.Add(1)
 	// logger.Infof("thread %d begin to run", id)
-	tp.wg.Add(1)
+	timer := time.NewTimer(tp.keepAlive)
+	defer timer.Stop()
 	for {
 		select {
-		case job := <-tp.jobSignal:
-			tp.running.Add(1)
+		case tp.ready <- struct{}{}:
+			//dispatch已经计入running并释放空位
+			t := <-tp.jobSignal
+			if t == nil {
+				return
+			}
 			// logger.Infof("%d begin to work, running %d", id, run)
-			job.Worker()
+			tp.run(t)
 			tp.running.Add(-1)
+			tp.checkDrained()
 			// logger.Infof("%d work done, running %d", id, run)
+			if !timer.Stop() {
+				<-timer.C
+			}
+			timer.Reset(tp.keepAlive)
+		case <-timer.C:
+			//空闲超时，协程数多于min时退出
+			if tp.shrink() {
+				return
+			}
+			timer.Reset(tp.keepAlive)
 		case <-tp.stopSignal:
 			// logger.Infof("%d exit", id)
-			tp.wg.Done()
 			return
 		}
 	}
 }
+
+// run 执行任务，AddKeyed提交的任务执行完后把同一个key上的下一个任务放入队列
+func (tp *ThreadPool) run(t *task) {
+	tp.runOne(t)
+	if t.keyed {
+		tp.finish(t.key)
+	}
+}
+
+// runOne 执行任务，任务的ctx在提交的ctx结束或者线程池停止时取消
+func (tp *ThreadPool) runOne(t *task) {
+	ctx := tp.ctx
+	if t.ctx != context.Background() {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithCancel(t.ctx)
+		defer cancel()
+		go func() {
+			select {
+			case <-tp.ctx.Done():
+				cancel()
+			case <-ctx.Done():
+			}
+		}()
+	}
+
+	start := time.Now()
+	info := JobInfo{Job: t.orig, Priority: t.priority, QueueWait: start.Sub(t.enqueued)}
+	tp.stats.queueWait.observe(info.QueueWait)
+
+	policy := tp.retryPolicyOf(t.orig)
+	var result interface{}
+	var err error
+	for {
+		info.Attempt++
+		info.RunTime, info.Err = 0, nil
+		if tp.beforeJob != nil {
+			tp.beforeJob(info)
+		}
+
+		start = time.Now()
+		result, err = call(ctx, t.job)
+
+		info.RunTime = time.Since(start)
+		info.Err = err
+		tp.stats.runTime.observe(info.RunTime)
+		if tp.afterJob != nil {
+			tp.afterJob(info)
+		}
+
+		if err == nil || policy == nil || info.Attempt >= policy.MaxAttempts || !policy.retryable(err) {
+			break
+		}
+		//线程池停止或者提交的ctx结束时不再重试
+		if !sleep(ctx, policy.backoff(info.Attempt)) {
+			break
+		}
+		//重试也是一次开始执行，同样需要令牌
+		if tp.limiter != nil && !tp.waitToken(ctx.Done()) {
+			break
+		}
+		tp.stats.retried.Add(1)
+	}
+
+	if err != nil {
+		tp.stats.failed.Add(1)
+		if policy != nil && policy.DeadLetter != nil {
+			policy.DeadLetter(t.orig, err, info.Attempt)
+		}
+	} else {
+		tp.stats.completed.Add(1)
+	}
+
+	//没有Future的任务失败时只计入Stats().Failed，需要错误内容时用WithAfterJob
+	if t.future != nil {
+		t.future.resolve(result, err)
+	}
+}
+
+// call 执行任务，任务panic时转换为PanicError
+func call(ctx context.Context, job ResultJob) (result interface{}, err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = &PanicError{Value: r, Stack: debug.Stack()}
+		}
+	}()
+	return job.Worker(ctx)
+}
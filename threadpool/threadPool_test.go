@@ -1,9 +1,13 @@
 package threadpool_test
 
 import (
+	"context"
+	"errors"
 	"fmt"
 	"math/rand"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"test/threadpool"
 	"testing"
 	"time"
@@ -55,7 +59,7 @@ func TestInitAndStop(t *testing.T) {
 
 type Job struct {
 	Idx  int
-	Lock sync.Mutex
+	Lock *sync.Mutex //所有任务共享，保护Num
 	Num  *int
 }
 
@@ -75,10 +79,1068 @@ func TestAddJob(t *testing.T) {
 	defer poll.Stop()
 
 	num := 0
+	lock := &sync.Mutex{}
 	for i := 0; i < 70; i++ {
-		if err := poll.Add(&Job{Idx: i, Num: &num}); err != nil {
+		if err := poll.Add(&Job{Idx: i, Lock: lock, Num: &num}); err != nil {
 			fmt.Println("Add failed with ", err)
 		}
 	}
 
 }
+
+type ctxJob struct {
+	started chan struct{}
+	err     chan error
+}
+
+func (job *ctxJob) Worker(ctx context.Context) {
+	close(job.started)
+	<-ctx.Done()
+	job.err <- ctx.Err()
+}
+
+func TestAddContext(t *testing.T) {
+	poll, err := threadpool.NewThreadPoolWithOptions(threadpool.WithThreads(1, 1), threadpool.WithQueue(1, threadpool.Block))
+	if err != nil {
+		t.Fatalf("create thread pool falied with %v", err)
+	}
+	defer poll.Stop()
+
+	//提交的ctx取消，任务收到取消
+	ctx, cancel := context.WithCancel(context.Background())
+	job := &ctxJob{started: make(chan struct{}), err: make(chan error, 1)}
+	if err := poll.AddContext(ctx, job); err != nil {
+		t.Fatalf("add job failed with %v", err)
+	}
+	<-job.started
+	queued := &ctxJob{started: make(chan struct{}), err: make(chan error, 1)}
+	if err := poll.AddContext(ctx, queued); err != nil {
+		t.Fatalf("add job failed with %v", err)
+	}
+
+	//唯一的协程在忙，队列也满了，等待超时
+	timeout, cancelTimeout := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancelTimeout()
+	if err := poll.AddContext(timeout, &ctxJob{started: make(chan struct{}), err: make(chan error, 1)}); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("add job want DeadlineExceeded but get %v", err)
+	}
+
+	cancel()
+	for _, j := range []*ctxJob{job, queued} {
+		if err := <-j.err; !errors.Is(err, context.Canceled) {
+			t.Fatalf("job want Canceled but get %v", err)
+		}
+	}
+	if err := poll.AddContext(ctx, job); !errors.Is(err, context.Canceled) {
+		t.Fatalf("add job with done ctx want Canceled but get %v", err)
+	}
+}
+
+func TestContextJobCancelledOnStop(t *testing.T) {
+	poll, err := threadpool.NewThreadPool(2)
+	if err != nil {
+		t.Fatalf("create thread pool falied with %v", err)
+	}
+
+	jobs := make([]*ctxJob, 2)
+	for i := range jobs {
+		jobs[i] = &ctxJob{started: make(chan struct{}), err: make(chan error, 1)}
+		if err := poll.AddContext(context.Background(), jobs[i]); err != nil {
+			t.Fatalf("add job failed with %v", err)
+		}
+		<-jobs[i].started
+	}
+
+	done := make(chan struct{})
+	go func() {
+		poll.Stop()
+		close(done)
+	}()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("stop blocked by running jobs")
+	}
+	for _, job := range jobs {
+		if err := <-job.err; !errors.Is(err, context.Canceled) {
+			t.Fatalf("job want Canceled but get %v", err)
+		}
+	}
+	if err := poll.Add(&Job{Num: new(int)}); !errors.Is(err, threadpool.ErrStopped) {
+		t.Fatalf("add after stop want ErrStopped but get %v", err)
+	}
+}
+
+func TestSubmit(t *testing.T) {
+	poll, err := threadpool.NewThreadPool(2)
+	if err != nil {
+		t.Fatalf("create thread pool falied with %v", err)
+	}
+
+	errBad := errors.New("bad job")
+	futures := make([]*threadpool.Future, 10)
+	for i := range futures {
+		i := i
+		futures[i] = poll.Submit(threadpool.JobFunc(func(ctx context.Context) (interface{}, error) {
+			if i%2 == 1 {
+				return nil, errBad
+			}
+			return i * i, nil
+		}))
+	}
+	for i, future := range futures {
+		<-future.Done()
+		result, err := future.Wait()
+		if i%2 == 1 {
+			if !errors.Is(err, errBad) {
+				t.Fatalf("job %d want errBad but get %v", i, err)
+			}
+			continue
+		}
+		if err != nil || result.(int) != i*i {
+			t.Fatalf("job %d get %v, %v", i, result, err)
+		}
+	}
+
+	poll.Stop()
+	if _, err := poll.Submit(threadpool.JobFunc(func(ctx context.Context) (interface{}, error) {
+		return nil, nil
+	})).Wait(); !errors.Is(err, threadpool.ErrStopped) {
+		t.Fatalf("submit after stop want ErrStopped but get %v", err)
+	}
+}
+
+type panicJob struct{}
+
+func (panicJob) Worker() {
+	panic("boom")
+}
+
+func TestPanicRecovered(t *testing.T) {
+	poll, err := threadpool.NewThreadPool(1, 1)
+	if err != nil {
+		t.Fatalf("create thread pool falied with %v", err)
+	}
+	defer poll.Stop()
+
+	_, err = poll.Submit(threadpool.JobFunc(func(ctx context.Context) (interface{}, error) {
+		panic("boom")
+	})).Wait()
+	var panicErr *threadpool.PanicError
+	if !errors.As(err, &panicErr) || panicErr.Value != "boom" || len(panicErr.Stack) == 0 {
+		t.Fatalf("want PanicError but get %v", err)
+	}
+
+	//Add提交的任务panic也不会导致进程退出，协程继续工作
+	if err := poll.Add(panicJob{}); err != nil {
+		t.Fatalf("add job failed with %v", err)
+	}
+	result, err := poll.Submit(threadpool.JobFunc(func(ctx context.Context) (interface{}, error) {
+		return "ok", nil
+	})).Wait()
+	if err != nil || result != "ok" {
+		t.Fatalf("job after panic get %v, %v", result, err)
+	}
+	if !strings.Contains(poll.Describe(), "running 0") {
+		t.Fatalf("running count wrong: %s", poll.Describe())
+	}
+	//没有Future的任务失败计入Stats
+	if stats := poll.Stats(); stats.Failed != 2 {
+		t.Fatalf("want 2 failed but get %d", stats.Failed)
+	}
+}
+
+type blockJob struct {
+	once    sync.Once
+	started chan struct{}
+	release chan struct{}
+}
+
+func (job *blockJob) Worker() {
+	job.once.Do(func() { close(job.started) })
+	<-job.release
+}
+
+func TestOverflowPolicy(t *testing.T) {
+	newPool := func(policy threadpool.OverflowPolicy) (*threadpool.ThreadPool, *blockJob) {
+		poll, err := threadpool.NewThreadPoolWithOptions(threadpool.WithThreads(1, 1), threadpool.WithQueue(2, policy))
+		if err != nil {
+			t.Fatalf("create thread pool falied with %v", err)
+		}
+		//占住唯一的协程，再把队列填满
+		block := &blockJob{started: make(chan struct{}), release: make(chan struct{})}
+		if err := poll.Add(block); err != nil {
+			t.Fatalf("add job failed with %v", err)
+		}
+		<-block.started
+		for i := 0; i < 2; i++ {
+			if err := poll.Add(block); err != nil {
+				t.Fatalf("add job failed with %v", err)
+			}
+		}
+		return poll, block
+	}
+	value := func(v interface{}) threadpool.JobFunc {
+		return func(ctx context.Context) (interface{}, error) { return v, nil }
+	}
+
+	poll, block := newPool(threadpool.FailFast)
+	if !strings.Contains(poll.Describe(), "queued 2/2") {
+		t.Fatalf("describe want queued 2/2 but get %s", poll.Describe())
+	}
+	if err := poll.Add(block); !errors.Is(err, threadpool.ErrQueueFull) {
+		t.Fatalf("fail fast want ErrQueueFull but get %v", err)
+	}
+	close(block.release)
+	poll.Stop()
+
+	poll, block = newPool(threadpool.CallerRuns)
+	if result, err := poll.Submit(value("caller")).Wait(); err != nil || result != "caller" {
+		t.Fatalf("caller runs get %v, %v", result, err)
+	}
+	close(block.release)
+	poll.Stop()
+
+	poll, block = newPool(threadpool.DropOldest)
+	//队列满时每次提交都丢弃一个更早的任务，最新的任务一定会执行
+	first := poll.Submit(value(1))
+	second := poll.Submit(value(2))
+	third := poll.Submit(value(3))
+	close(block.release)
+	//三次提交依次丢弃排队的两个block任务和first
+	if _, err := first.Wait(); !errors.Is(err, threadpool.ErrDropped) {
+		t.Fatalf("oldest job want ErrDropped but get %v", err)
+	}
+	for i, future := range []*threadpool.Future{second, third} {
+		if result, err := future.Wait(); err != nil || result != i+2 {
+			t.Fatalf("job %d get %v, %v", i+2, result, err)
+		}
+	}
+	poll.Stop()
+
+	//队列长度为1，协程忙时提交也不会阻塞
+	poll, err := threadpool.NewThreadPoolWithOptions(threadpool.WithThreads(1, 1), threadpool.WithQueue(1, threadpool.DropOldest))
+	if err != nil {
+		t.Fatalf("create thread pool falied with %v", err)
+	}
+	block = &blockJob{started: make(chan struct{}), release: make(chan struct{})}
+	poll.Add(block)
+	<-block.started
+	futures := make([]*threadpool.Future, 0)
+	added := make(chan struct{})
+	go func() {
+		defer close(added)
+		for i := 0; i < 3; i++ {
+			futures = append(futures, poll.Submit(value(i)))
+		}
+	}()
+	select {
+	case <-added:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("submit blocked on full queue with drop oldest")
+	}
+	close(block.release)
+	for i, future := range futures {
+		result, err := future.Wait()
+		if i < 2 && !errors.Is(err, threadpool.ErrDropped) {
+			t.Fatalf("job %d want ErrDropped but get %v, %v", i, result, err)
+		}
+		if i == 2 && (err != nil || result != 2) {
+			t.Fatalf("newest job get %v, %v", result, err)
+		}
+	}
+	poll.Stop()
+
+	if _, err := threadpool.NewThreadPoolWithOptions(threadpool.WithQueue(0, threadpool.Block)); err == nil {
+		t.Fatalf("create with bad queue size want err but not")
+	}
+}
+
+type priorityJob struct {
+	priority int
+	mu       *sync.Mutex
+	order    *[]int
+}
+
+func (job *priorityJob) Priority() int {
+	return job.priority
+}
+
+func (job *priorityJob) Worker() {
+	job.mu.Lock()
+	defer job.mu.Unlock()
+	*job.order = append(*job.order, job.priority)
+}
+
+func TestPriority(t *testing.T) {
+	run := func(aging time.Duration, add func(poll *threadpool.ThreadPool, newJob func(int) *priorityJob)) []int {
+		poll, err := threadpool.NewThreadPoolWithOptions(threadpool.WithThreads(1, 1), threadpool.WithPriority(aging))
+		if err != nil {
+			t.Fatalf("create thread pool falied with %v", err)
+		}
+		//占住唯一的协程，让任务都留在队列里
+		block := &blockJob{started: make(chan struct{}), release: make(chan struct{})}
+		if err := poll.Add(block); err != nil {
+			t.Fatalf("add job failed with %v", err)
+		}
+		<-block.started
+
+		mu := &sync.Mutex{}
+		order := make([]int, 0)
+		add(poll, func(priority int) *priorityJob {
+			return &priorityJob{priority: priority, mu: mu, order: &order}
+		})
+		close(block.release)
+		poll.Stop()
+		return order
+	}
+
+	order := run(0, func(poll *threadpool.ThreadPool, newJob func(int) *priorityJob) {
+		for _, priority := range []int{1, 5, 3, 5, 0, 9} {
+			if err := poll.Add(newJob(priority)); err != nil {
+				t.Fatalf("add job failed with %v", err)
+			}
+		}
+	})
+	if fmt.Sprint(order) != "[9 5 5 3 1 0]" {
+		t.Fatalf("want [9 5 5 3 1 0] but get %v", order)
+	}
+
+	//每等待1ms优先级加1，等待50ms的低优先级任务排在优先级10的新任务前面
+	order = run(time.Millisecond, func(poll *threadpool.ThreadPool, newJob func(int) *priorityJob) {
+		if err := poll.Add(newJob(0)); err != nil {
+			t.Fatalf("add job failed with %v", err)
+		}
+		time.Sleep(50 * time.Millisecond)
+		if err := poll.Add(newJob(10)); err != nil {
+			t.Fatalf("add job failed with %v", err)
+		}
+	})
+	if fmt.Sprint(order) != "[0 10]" {
+		t.Fatalf("aging want [0 10] but get %v", order)
+	}
+
+	if _, err := threadpool.NewThreadPoolWithOptions(threadpool.WithPriority(-time.Second)); err == nil {
+		t.Fatalf("create with bad aging want err but not")
+	}
+}
+
+func TestGrowAndShrink(t *testing.T) {
+	poll, err := threadpool.NewThreadPoolWithOptions(threadpool.WithThreads(1, 8), threadpool.WithKeepAlive(20*time.Millisecond))
+	if err != nil {
+		t.Fatalf("create thread pool falied with %v", err)
+	}
+	defer poll.Stop()
+
+	//8个任务同时阻塞，协程扩展到max
+	release := make(chan struct{})
+	blocks := make([]*blockJob, 8)
+	for i := range blocks {
+		blocks[i] = &blockJob{started: make(chan struct{}), release: release}
+		if err := poll.Add(blocks[i]); err != nil {
+			t.Fatalf("add job failed with %v", err)
+		}
+	}
+	for _, block := range blocks {
+		<-block.started
+	}
+	if !strings.Contains(poll.Describe(), "maxIdle 8,") {
+		t.Fatalf("want 8 threads but get %s", poll.Describe())
+	}
+
+	//空闲超时后缩回初始协程数
+	close(release)
+	deadline := time.Now().Add(2 * time.Second)
+	for !strings.Contains(poll.Describe(), "maxIdle 1,") {
+		if time.Now().After(deadline) {
+			t.Fatalf("threads not shrink: %s", poll.Describe())
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	if _, err := threadpool.NewThreadPoolWithOptions(threadpool.WithKeepAlive(0)); err == nil {
+		t.Fatalf("create with bad keep alive want err but not")
+	}
+}
+
+func TestConcurrentAdd(t *testing.T) {
+	poll, err := threadpool.NewThreadPoolWithOptions(threadpool.WithThreads(2, 16), threadpool.WithKeepAlive(time.Millisecond))
+	if err != nil {
+		t.Fatalf("create thread pool falied with %v", err)
+	}
+
+	var done sync.WaitGroup
+	var count int64
+	lock := sync.Mutex{}
+	wg := sync.WaitGroup{}
+	for i := 0; i < 32; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < 100; j++ {
+				done.Add(1)
+				future := poll.Submit(threadpool.JobFunc(func(ctx context.Context) (interface{}, error) {
+					defer done.Done()
+					lock.Lock()
+					count++
+					lock.Unlock()
+					return nil, nil
+				}))
+				if j%10 == 0 {
+					if _, err := future.Wait(); err != nil {
+						t.Errorf("job failed with %v", err)
+					}
+				}
+			}
+		}()
+	}
+	wg.Wait()
+	done.Wait()
+	poll.Stop()
+
+	if count != 3200 {
+		t.Fatalf("want 3200 jobs done but get %d", count)
+	}
+	if err := poll.Add(&blockJob{}); !errors.Is(err, threadpool.ErrStopped) {
+		t.Fatalf("add after stop want ErrStopped but get %v", err)
+	}
+}
+
+func TestShutdown(t *testing.T) {
+	newPool := func() (*threadpool.ThreadPool, *blockJob, []*threadpool.Future) {
+		poll, err := threadpool.NewThreadPoolWithOptions(threadpool.WithThreads(1, 1))
+		if err != nil {
+			t.Fatalf("create thread pool falied with %v", err)
+		}
+		block := &blockJob{started: make(chan struct{}), release: make(chan struct{})}
+		if err := poll.Add(block); err != nil {
+			t.Fatalf("add job failed with %v", err)
+		}
+		<-block.started
+		futures := make([]*threadpool.Future, 0)
+		for i := 0; i < 3; i++ {
+			v := i
+			futures = append(futures, poll.Submit(threadpool.JobFunc(func(ctx context.Context) (interface{}, error) { return v, nil })))
+		}
+		return poll, block, futures
+	}
+
+	//正常停止，队列里的任务都执行完
+	poll, block, futures := newPool()
+	close(block.release)
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	if err := poll.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown failed with %v", err)
+	}
+	cancel()
+	for i, future := range futures {
+		if result, err := future.Wait(); err != nil || result != i {
+			t.Fatalf("job %d get %v, %v", i, result, err)
+		}
+	}
+	if err := poll.Add(block); !errors.Is(err, threadpool.ErrStopped) {
+		t.Fatalf("add after shutdown want ErrStopped but get %v", err)
+	}
+
+	//协程一直阻塞，超时返回，没开始的任务被丢弃
+	poll, block, futures = newPool()
+	ctx, cancel = context.WithTimeout(context.Background(), 50*time.Millisecond)
+	if err := poll.Shutdown(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("shutdown want DeadlineExceeded but get %v", err)
+	}
+	cancel()
+	for i, future := range futures {
+		if _, err := future.Wait(); !errors.Is(err, threadpool.ErrStopped) {
+			t.Fatalf("job %d want ErrStopped but get %v", i, err)
+		}
+	}
+	close(block.release)
+
+	//立即停止，返回没开始的任务
+	poll, block, futures = newPool()
+	extra := &blockJob{}
+	if err := poll.Add(extra); err != nil {
+		t.Fatalf("add job failed with %v", err)
+	}
+	jobs := poll.ShutdownNow()
+	if len(jobs) != 4 || jobs[3] != extra {
+		t.Fatalf("shutdown now want 4 jobs but get %v", jobs)
+	}
+	for i, future := range futures {
+		if _, err := future.Wait(); !errors.Is(err, threadpool.ErrStopped) {
+			t.Fatalf("job %d want ErrStopped but get %v", i, err)
+		}
+	}
+	close(block.release)
+	poll.Stop()
+
+	//和ShutdownNow并发提交的任务要么被执行，要么Future返回错误，不会一直等待
+	for _, policy := range []threadpool.OverflowPolicy{threadpool.FailFast, threadpool.DropOldest} {
+		poll, err := threadpool.NewThreadPoolWithOptions(threadpool.WithThreads(1, 1), threadpool.WithQueue(8, policy))
+		if err != nil {
+			t.Fatalf("create thread pool falied with %v", err)
+		}
+		block := &blockJob{started: make(chan struct{}), release: make(chan struct{})}
+		poll.Add(block)
+		<-block.started
+		mu := sync.Mutex{}
+		futures := make([]*threadpool.Future, 0)
+		wg := sync.WaitGroup{}
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				for j := 0; j < 200; j++ {
+					future := poll.Submit(threadpool.JobFunc(func(ctx context.Context) (interface{}, error) { return nil, nil }))
+					mu.Lock()
+					futures = append(futures, future)
+					mu.Unlock()
+				}
+			}()
+		}
+		poll.ShutdownNow()
+		wg.Wait()
+		close(block.release)
+		poll.Stop()
+		for i, future := range futures {
+			select {
+			case <-future.Done():
+			case <-time.After(5 * time.Second):
+				t.Fatalf("policy %v future %d never resolved", policy, i)
+			}
+		}
+	}
+}
+
+func TestStatsAndHooks(t *testing.T) {
+	lock := sync.Mutex{}
+	before, after := 0, make([]threadpool.JobInfo, 0)
+	poll, err := threadpool.NewThreadPoolWithOptions(
+		threadpool.WithThreads(1, 1),
+		threadpool.WithQueue(4, threadpool.FailFast),
+		threadpool.WithBuckets(time.Millisecond, time.Second),
+		threadpool.WithBeforeJob(func(info threadpool.JobInfo) {
+			lock.Lock()
+			before++
+			lock.Unlock()
+		}),
+		threadpool.WithAfterJob(func(info threadpool.JobInfo) {
+			lock.Lock()
+			after = append(after, info)
+			lock.Unlock()
+		}),
+	)
+	if err != nil {
+		t.Fatalf("create thread pool falied with %v", err)
+	}
+
+	block := &blockJob{started: make(chan struct{}), release: make(chan struct{})}
+	if err := poll.Add(block); err != nil {
+		t.Fatalf("add job failed with %v", err)
+	}
+	<-block.started
+	futures := []*threadpool.Future{
+		poll.Submit(threadpool.JobFunc(func(ctx context.Context) (interface{}, error) { return nil, nil })),
+		poll.Submit(threadpool.JobFunc(func(ctx context.Context) (interface{}, error) { return nil, errors.New("failed") })),
+		poll.Submit(threadpool.JobFunc(func(ctx context.Context) (interface{}, error) { panic("boom") })),
+		poll.Submit(threadpool.JobFunc(func(ctx context.Context) (interface{}, error) { return nil, nil })),
+	}
+	if _, err := poll.Submit(threadpool.JobFunc(func(ctx context.Context) (interface{}, error) { return nil, nil })).Wait(); !errors.Is(err, threadpool.ErrQueueFull) {
+		t.Fatalf("want ErrQueueFull but get %v", err)
+	}
+
+	stats := poll.Stats()
+	if stats.QueueDepth != 4 || stats.Active != 1 || stats.Threads != 1 || stats.Submitted != 5 || stats.Rejected != 1 {
+		t.Fatalf("stats wrong: %+v", stats)
+	}
+
+	close(block.release)
+	for _, future := range futures {
+		future.Wait()
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+	defer cancel()
+	if err := poll.Shutdown(ctx); err != nil {
+		t.Fatalf("shutdown failed with %v", err)
+	}
+
+	stats = poll.Stats()
+	if stats.Completed != 3 || stats.Failed != 2 || stats.QueueDepth != 0 || stats.Active != 0 {
+		t.Fatalf("stats wrong: %+v", stats)
+	}
+	if len(stats.RunTime.Counts) != 3 || stats.RunTime.Count != 5 || stats.QueueWait.Count != 5 {
+		t.Fatalf("histogram wrong: %+v, %+v", stats.RunTime, stats.QueueWait)
+	}
+	total := uint64(0)
+	for _, n := range stats.RunTime.Counts {
+		total += n
+	}
+	if total != 5 {
+		t.Fatalf("histogram counts %v not sum to 5", stats.RunTime.Counts)
+	}
+
+	lock.Lock()
+	defer lock.Unlock()
+	if before != 5 || len(after) != 5 {
+		t.Fatalf("hooks called %d, %d times", before, len(after))
+	}
+	if after[0].Job != block || after[0].RunTime <= 0 {
+		t.Fatalf("first job info wrong: %+v", after[0])
+	}
+	if after[2].Err == nil || after[3].Err == nil {
+		t.Fatalf("failed job info has no err: %+v, %+v", after[2], after[3])
+	}
+}
+
+type keyedJob struct {
+	idx     int
+	mu      *sync.Mutex
+	running map[string]int
+	order   map[string][]int
+	key     string
+	overlap *bool
+}
+
+func (job *keyedJob) Worker() {
+	job.mu.Lock()
+	job.running[job.key]++
+	if job.running[job.key] > 1 {
+		*job.overlap = true
+	}
+	job.order[job.key] = append(job.order[job.key], job.idx)
+	job.mu.Unlock()
+
+	time.Sleep(time.Millisecond)
+
+	job.mu.Lock()
+	job.running[job.key]--
+	job.mu.Unlock()
+}
+
+func TestAddKeyed(t *testing.T) {
+	poll, err := threadpool.NewThreadPool(4, 4)
+	if err != nil {
+		t.Fatalf("create thread pool falied with %v", err)
+	}
+
+	mu := &sync.Mutex{}
+	running := make(map[string]int)
+	order := make(map[string][]int)
+	overlap := false
+	keys := []string{"/dataset/a", "/dataset/b", "/dataset/c"}
+	for i := 0; i < 20; i++ {
+		for _, key := range keys {
+			job := &keyedJob{idx: i, mu: mu, running: running, order: order, key: key, overlap: &overlap}
+			if err := poll.AddKeyed(key, job); err != nil {
+				t.Fatalf("add keyed job failed with %v", err)
+			}
+		}
+	}
+	poll.Stop()
+
+	if overlap {
+		t.Fatalf("jobs with same key run at the same time")
+	}
+	for _, key := range keys {
+		if len(order[key]) != 20 {
+			t.Fatalf("%s want 20 jobs but get %d", key, len(order[key]))
+		}
+		for i, idx := range order[key] {
+			if idx != i {
+				t.Fatalf("%s jobs not in order: %v", key, order[key])
+			}
+		}
+	}
+	if err := poll.AddKeyed(keys[0], &blockJob{}); !errors.Is(err, threadpool.ErrStopped) {
+		t.Fatalf("add keyed after stop want ErrStopped but get %v", err)
+	}
+
+	//挂在key后面的任务也会被ShutdownNow返回
+	poll, err = threadpool.NewThreadPool(1, 1)
+	if err != nil {
+		t.Fatalf("create thread pool falied with %v", err)
+	}
+	block := &blockJob{started: make(chan struct{}), release: make(chan struct{})}
+	if err := poll.AddKeyed("key", block); err != nil {
+		t.Fatalf("add keyed job failed with %v", err)
+	}
+	<-block.started
+	second := &blockJob{}
+	if err := poll.AddKeyed("key", second); err != nil {
+		t.Fatalf("add keyed job failed with %v", err)
+	}
+	if jobs := poll.ShutdownNow(); len(jobs) != 1 || jobs[0] != second {
+		t.Fatalf("shutdown now want second job but get %v", jobs)
+	}
+	close(block.release)
+	poll.Stop()
+
+	//挂在key后面的任务占用队列空位，队列满时按policy处理
+	poll, err = threadpool.NewThreadPoolWithOptions(threadpool.WithThreads(1, 1), threadpool.WithQueue(2, threadpool.FailFast))
+	if err != nil {
+		t.Fatalf("create thread pool falied with %v", err)
+	}
+	block = &blockJob{started: make(chan struct{}), release: make(chan struct{})}
+	if err := poll.AddKeyed("key", block); err != nil {
+		t.Fatalf("add keyed job failed with %v", err)
+	}
+	<-block.started
+	for i := 0; i < 2; i++ {
+		if err := poll.AddKeyed("key", &countJob{}); err != nil {
+			t.Fatalf("add keyed job failed with %v", err)
+		}
+	}
+	if err := poll.AddKeyed("key", &countJob{}); !errors.Is(err, threadpool.ErrQueueFull) {
+		t.Fatalf("add keyed on full queue want ErrQueueFull but get %v", err)
+	}
+	if stats := poll.Stats(); stats.QueueDepth != 2 {
+		t.Fatalf("want queue depth 2 but get %d", stats.QueueDepth)
+	}
+	if !strings.Contains(poll.Describe(), "queued 2/2") {
+		t.Fatalf("describe want queued 2/2 but get %s", poll.Describe())
+	}
+	close(block.release)
+	poll.Stop()
+
+	//CallerRuns只在调用者的协程里执行提交的任务，key上之后的任务交给线程池
+	poll, err = threadpool.NewThreadPoolWithOptions(threadpool.WithThreads(1, 1), threadpool.WithQueue(1, threadpool.CallerRuns))
+	if err != nil {
+		t.Fatalf("create thread pool falied with %v", err)
+	}
+	block = &blockJob{started: make(chan struct{}), release: make(chan struct{})}
+	poll.Add(block)
+	<-block.started
+	poll.Add(&countJob{})
+	first := &blockJob{started: make(chan struct{}), release: make(chan struct{})}
+	callerDone := make(chan error, 1)
+	go func() {
+		callerDone <- poll.AddKeyed("key", first)
+	}()
+	<-first.started
+	second = &blockJob{started: make(chan struct{}), release: make(chan struct{})}
+	secondAdded := make(chan error, 1)
+	go func() {
+		secondAdded <- poll.AddKeyed("key", second)
+	}()
+	close(block.release)
+	if err := <-secondAdded; err != nil {
+		t.Fatalf("add keyed job failed with %v", err)
+	}
+	close(first.release)
+	select {
+	case err := <-callerDone:
+		if err != nil {
+			t.Fatalf("caller runs keyed job failed with %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("caller runs keyed job also run the next job on the same key")
+	}
+	<-second.started
+	close(second.release)
+	poll.Stop()
+
+	//DropOldest丢弃key上排队的任务时，这个key上的下一个任务放入队列，之后这个key上的任务正常执行
+	poll, err = threadpool.NewThreadPoolWithOptions(threadpool.WithThreads(1, 1), threadpool.WithQueue(2, threadpool.DropOldest), threadpool.WithPriority(0))
+	if err != nil {
+		t.Fatalf("create thread pool falied with %v", err)
+	}
+	block = &blockJob{started: make(chan struct{}), release: make(chan struct{})}
+	poll.Add(block)
+	<-block.started
+	ran := []int{}
+	newJob := func(priority int) *priorityJob {
+		return &priorityJob{priority: priority, mu: mu, order: &ran}
+	}
+	poll.Add(newJob(10))
+	for _, priority := range []int{0, 1} {
+		if err := poll.AddKeyed("key", newJob(priority)); err != nil {
+			t.Fatalf("add keyed job failed with %v", err)
+		}
+	}
+	//提交第二个key上的任务时队列已满，丢弃优先级最低的key上第一个任务，第二个任务放入队列，
+	//之后队列满再丢弃它
+	poll.Add(newJob(9))
+	close(block.release)
+	//等10开始执行，释放队列空位
+	for done := false; !done; time.Sleep(time.Millisecond) {
+		mu.Lock()
+		done = len(ran) > 0
+		mu.Unlock()
+	}
+	if err := poll.AddKeyed("key", newJob(7)); err != nil {
+		t.Fatalf("add keyed job failed with %v", err)
+	}
+	poll.Stop()
+	if len(ran) != 3 || ran[0] != 10 || ran[1] != 9 || ran[2] != 7 {
+		t.Fatalf("want [10 9 7] but get %v", ran)
+	}
+	if stats := poll.Stats(); stats.Dropped != 2 {
+		t.Fatalf("want 2 dropped but get %d", stats.Dropped)
+	}
+}
+
+type countJob struct {
+	count atomic.Int32
+}
+
+func (job *countJob) Worker() {
+	job.count.Add(1)
+}
+
+func TestRateLimit(t *testing.T) {
+	poll, err := threadpool.NewThreadPoolWithOptions(threadpool.WithThreads(4, 4), threadpool.WithRateLimit(50, 1))
+	if err != nil {
+		t.Fatalf("create thread pool falied with %v", err)
+	}
+
+	//每秒50个，11个任务至少需要200ms
+	job := &countJob{}
+	begin := time.Now()
+	for i := 0; i < 11; i++ {
+		if err := poll.Add(job); err != nil {
+			t.Fatalf("add job failed with %v", err)
+		}
+	}
+	poll.Stop()
+	if elapsed := time.Since(begin); elapsed < 150*time.Millisecond {
+		t.Fatalf("11 jobs done in %v, rate limit not work", elapsed)
+	}
+	if job.count.Load() != 11 {
+		t.Fatalf("want 11 jobs done but get %d", job.count.Load())
+	}
+
+	//同一个key上的任务和重试同样受限速
+	poll, err = threadpool.NewThreadPoolWithOptions(threadpool.WithThreads(4, 4), threadpool.WithRateLimit(50, 1))
+	if err != nil {
+		t.Fatalf("create thread pool falied with %v", err)
+	}
+	job = &countJob{}
+	begin = time.Now()
+	for i := 0; i < 11; i++ {
+		if err := poll.AddKeyed("key", job); err != nil {
+			t.Fatalf("add keyed job failed with %v", err)
+		}
+	}
+	poll.Stop()
+	if elapsed := time.Since(begin); elapsed < 150*time.Millisecond {
+		t.Fatalf("11 keyed jobs done in %v, rate limit not work", elapsed)
+	}
+	if job.count.Load() != 11 {
+		t.Fatalf("want 11 keyed jobs done but get %d", job.count.Load())
+	}
+
+	poll, err = threadpool.NewThreadPoolWithOptions(threadpool.WithRateLimit(50, 1), threadpool.WithRetry(threadpool.RetryPolicy{MaxAttempts: 11}))
+	if err != nil {
+		t.Fatalf("create thread pool falied with %v", err)
+	}
+	flaky := &flakyJob{failures: 10, err: errors.New("temporary")}
+	begin = time.Now()
+	if _, err := poll.Submit(flaky).Wait(); err != nil {
+		t.Fatalf("flaky job failed with %v", err)
+	}
+	poll.Stop()
+	if elapsed := time.Since(begin); elapsed < 150*time.Millisecond {
+		t.Fatalf("11 attempts done in %v, rate limit not work", elapsed)
+	}
+
+	if _, err := threadpool.NewThreadPoolWithOptions(threadpool.WithRateLimit(0, 1)); err == nil {
+		t.Fatalf("create with bad rate want err but not")
+	}
+}
+
+func TestSchedule(t *testing.T) {
+	poll, err := threadpool.NewThreadPool()
+	if err != nil {
+		t.Fatalf("create thread pool falied with %v", err)
+	}
+
+	delayed := &countJob{}
+	s, err := poll.Schedule(delayed, 20*time.Millisecond)
+	if err != nil {
+		t.Fatalf("schedule failed with %v", err)
+	}
+	<-s.Done()
+
+	cancelled := &countJob{}
+	s, err = poll.Schedule(cancelled, time.Hour)
+	if err != nil {
+		t.Fatalf("schedule failed with %v", err)
+	}
+	s.Cancel()
+	s.Cancel()
+	<-s.Done()
+
+	periodic := &countJob{}
+	s, err = poll.ScheduleEvery(periodic, 5*time.Millisecond)
+	if err != nil {
+		t.Fatalf("schedule every failed with %v", err)
+	}
+	deadline := time.Now().Add(2 * time.Second)
+	for periodic.count.Load() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("periodic job only run %d times", periodic.count.Load())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	s.Cancel()
+	<-s.Done()
+
+	//线程池停止后周期任务也停止
+	s, err = poll.ScheduleEvery(&countJob{}, time.Hour)
+	if err != nil {
+		t.Fatalf("schedule every failed with %v", err)
+	}
+	poll.Stop()
+	<-s.Done()
+
+	if delayed.count.Load() != 1 || cancelled.count.Load() != 0 {
+		t.Fatalf("delayed job run %d times, cancelled job run %d times", delayed.count.Load(), cancelled.count.Load())
+	}
+	if _, err := poll.Schedule(delayed, 0); !errors.Is(err, threadpool.ErrStopped) {
+		t.Fatalf("schedule after stop want ErrStopped but get %v", err)
+	}
+	if _, err := poll.ScheduleEvery(delayed, 0); err == nil {
+		t.Fatalf("schedule every with bad interval want err but not")
+	}
+
+	//提交失败的错误通过Err返回
+	poll, err = threadpool.NewThreadPoolWithOptions(threadpool.WithThreads(1, 1), threadpool.WithQueue(1, threadpool.FailFast))
+	if err != nil {
+		t.Fatalf("create thread pool falied with %v", err)
+	}
+	block := &blockJob{started: make(chan struct{}), release: make(chan struct{})}
+	poll.Add(block)
+	<-block.started
+	poll.Add(&countJob{})
+	s, err = poll.Schedule(&countJob{}, 0)
+	if err != nil {
+		t.Fatalf("schedule failed with %v", err)
+	}
+	<-s.Done()
+	if !errors.Is(s.Err(), threadpool.ErrQueueFull) {
+		t.Fatalf("schedule on full queue want ErrQueueFull but get %v", s.Err())
+	}
+	s, err = poll.Schedule(&countJob{}, time.Hour)
+	if err != nil {
+		t.Fatalf("schedule failed with %v", err)
+	}
+	close(block.release)
+	poll.Stop()
+	<-s.Done()
+	if !errors.Is(s.Err(), threadpool.ErrStopped) {
+		t.Fatalf("schedule before stop want ErrStopped but get %v", s.Err())
+	}
+
+	//周期任务被DropOldest丢弃后，之后照常提交
+	poll, err = threadpool.NewThreadPoolWithOptions(threadpool.WithThreads(1, 1), threadpool.WithQueue(1, threadpool.DropOldest))
+	if err != nil {
+		t.Fatalf("create thread pool falied with %v", err)
+	}
+	block = &blockJob{started: make(chan struct{}), release: make(chan struct{})}
+	poll.Add(block)
+	<-block.started
+	periodic = &countJob{}
+	s, err = poll.ScheduleEvery(periodic, 5*time.Millisecond)
+	if err != nil {
+		t.Fatalf("schedule every failed with %v", err)
+	}
+	deadline = time.Now().Add(2 * time.Second)
+	for poll.Stats().QueueDepth == 0 {
+		if time.Now().After(deadline) {
+			t.Fatalf("periodic job never queued")
+		}
+		time.Sleep(time.Millisecond)
+	}
+	poll.Add(&countJob{})
+	for !errors.Is(s.Err(), threadpool.ErrDropped) {
+		if time.Now().After(deadline) {
+			t.Fatalf("dropped periodic job want ErrDropped but get %v", s.Err())
+		}
+		time.Sleep(time.Millisecond)
+	}
+	close(block.release)
+	for periodic.count.Load() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("periodic job only run %d times after dropped", periodic.count.Load())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	s.Cancel()
+	<-s.Done()
+	poll.Stop()
+}
+
+type flakyJob struct {
+	failures int //前failures次返回错误
+	err      error
+	attempts atomic.Int32
+}
+
+func (job *flakyJob) Worker(ctx context.Context) (interface{}, error) {
+	if int(job.attempts.Add(1)) <= job.failures {
+		return nil, job.err
+	}
+	return "ok", nil
+}
+
+type noRetryJob struct {
+	flakyJob
+}
+
+func (job *noRetryJob) RetryPolicy() *threadpool.RetryPolicy {
+	return nil
+}
+
+func TestRetry(t *testing.T) {
+	errTemporary := errors.New("temporary")
+	errPermanent := errors.New("permanent")
+	lock := sync.Mutex{}
+	dead := make(map[interface{}]int)
+	poll, err := threadpool.NewThreadPoolWithOptions(threadpool.WithRetry(threadpool.RetryPolicy{
+		MaxAttempts:    3,
+		InitialBackoff: time.Millisecond,
+		MaxBackoff:     5 * time.Millisecond,
+		Jitter:         0.5,
+		Retryable:      func(err error) bool { return !errors.Is(err, errPermanent) },
+		DeadLetter: func(job interface{}, err error, attempts int) {
+			lock.Lock()
+			dead[job] = attempts
+			lock.Unlock()
+		},
+	}))
+	if err != nil {
+		t.Fatalf("create thread pool falied with %v", err)
+	}
+
+	recovered := &flakyJob{failures: 2, err: errTemporary}
+	exhausted := &flakyJob{failures: 10, err: errTemporary}
+	permanent := &flakyJob{failures: 10, err: errPermanent}
+	noRetry := &noRetryJob{flakyJob{failures: 10, err: errTemporary}}
+
+	if result, err := poll.Submit(recovered).Wait(); err != nil || result != "ok" || recovered.attempts.Load() != 3 {
+		t.Fatalf("recovered job get %v, %v after %d attempts", result, err, recovered.attempts.Load())
+	}
+	if _, err := poll.Submit(exhausted).Wait(); !errors.Is(err, errTemporary) || exhausted.attempts.Load() != 3 {
+		t.Fatalf("exhausted job get %v after %d attempts", err, exhausted.attempts.Load())
+	}
+	if _, err := poll.Submit(permanent).Wait(); !errors.Is(err, errPermanent) || permanent.attempts.Load() != 1 {
+		t.Fatalf("permanent job get %v after %d attempts", err, permanent.attempts.Load())
+	}
+	if _, err := poll.Submit(noRetry).Wait(); !errors.Is(err, errTemporary) || noRetry.attempts.Load() != 1 {
+		t.Fatalf("no retry job get %v after %d attempts", err, noRetry.attempts.Load())
+	}
+	poll.Stop()
+
+	lock.Lock()
+	defer lock.Unlock()
+	if len(dead) != 2 || dead[exhausted] != 3 || dead[permanent] != 1 {
+		t.Fatalf("dead letter get %v", dead)
+	}
+	if stats := poll.Stats(); stats.Retried != 4 || stats.Failed != 3 || stats.Completed != 1 {
+		t.Fatalf("stats wrong: %+v", stats)
+	}
+
+	if _, err := threadpool.NewThreadPoolWithOptions(threadpool.WithRetry(threadpool.RetryPolicy{Jitter: 2})); err == nil {
+		t.Fatalf("create with bad retry policy want err but not")
+	}
+}